@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-manager-app/mailer"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeleteAccountRequest is the body of POST /api/account/delete. The password
+// is left out by accounts that do not have one.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// writeJSONFile adds a pretty-printed JSON file to the archive.
+func writeJSONFile(archive *zip.Writer, name string, value interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// formatOptionalTime formats t as RFC 3339, or returns an empty string for nil.
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatOptionalID formats id, or returns an empty string for nil.
+func formatOptionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// formatDeletedAt formats when a row was soft-deleted, or returns an empty
+// string when it was not.
+func formatDeletedAt(deletedAt gorm.DeletedAt) string {
+	if !deletedAt.Valid {
+		return ""
+	}
+	return deletedAt.Time.Format(time.RFC3339)
+}
+
+// labelNames joins the names of the labels with semicolons.
+func labelNames(labels []models.Label) string {
+	names := make([]string, 0, len(labels))
+	for _, label := range labels {
+		names = append(names, label.Name)
+	}
+	return strings.Join(names, ";")
+}
+
+// writeTasksCSV adds the tasks as a CSV file to the archive.
+func writeTasksCSV(archive *zip.Writer, name string, tasks []models.Task) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "project_id", "title", "description", "status", "priority", "start_at", "due_at", "all_day", "timezone", "labels", "created_at", "updated_at", "deleted_at"})
+	for _, task := range tasks {
+		out.Write([]string{
+			task.ID.String(),
+			formatOptionalID(task.ProjectID),
+			task.Title,
+			task.Description,
+			task.Status,
+			task.Priority,
+			formatOptionalTime(task.StartAt),
+			formatOptionalTime(task.DueAt),
+			strconv.FormatBool(task.AllDay),
+			task.TimeZone,
+			labelNames(task.Labels),
+			task.CreatedAt.Format(time.RFC3339),
+			task.UpdatedAt.Format(time.RFC3339),
+			formatDeletedAt(task.DeletedAt),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// buildExportArchive collects everything stored about the user into a zip
+// archive. Tasks, projects and labels in the trash are included, marked by
+// their deleted_at.
+func buildExportArchive(user *models.User) ([]byte, error) {
+	var tasks []models.Task
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Order("created_at").Preload("Labels").Preload("Checklist", orderChecklist).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	var projects []models.Project
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Order("sort_order, created_at").Find(&projects).Error; err != nil {
+		return nil, err
+	}
+
+	var labels []models.Label
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Order("name").Find(&labels).Error; err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if err := writeJSONFile(archive, "profile.json", user); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(archive, "tasks.json", tasks); err != nil {
+		return nil, err
+	}
+	if err := writeTasksCSV(archive, "tasks.csv", tasks); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(archive, "projects.json", projects); err != nil {
+		return nil, err
+	}
+	if err := writeJSONFile(archive, "labels.json", labels); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func ExportAccountData(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	data, err := buildExportArchive(user)
+	if err != nil {
+		log.Println("Error exporting account data:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export account data"})
+		return
+	}
+
+	filename := "task-manager-export-" + time.Now().Format("20060102") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+func DeleteAccount(c *gin.Context) {
+	auth := middleware.CurrentAuth(c)
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	if err := confirmIdentity(auth, req.Password); err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+	// The account goes to the trash like one deleted by an admin and is
+	// purged with it, see purgeTrashedUsers
+	purgeAt := time.Now().Add(trashRetention)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(auth.User).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", auth.User.ID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, auth.User.ID)
+	})
+	if err != nil {
+		log.Println("Error deleting account:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+
+	if err := mail.Send(mailer.Message{
+		To:      auth.User.Email,
+		Subject: "Your account will be deleted",
+		Body: "Hi " + auth.User.FirstName + ",\n\n" +
+			"Your account and all of your tasks will be permanently deleted on " + purgeAt.Format(time.RFC1123) + ".\n" +
+			"Reply to this email before then if you change your mind, an administrator can restore the account.\n",
+	}); err != nil {
+		log.Println("Error sending account deletion notice:", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "your account was deleted", "purge_at": purgeAt})
+}
+
+// purgeUser hard-deletes the user together with everything that belongs to them.
+func purgeUser(tx *gorm.DB, user *models.User) error {
+	tasks := tx.Unscoped().Model(&models.Task{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("task_id IN (?)", tasks).Delete(&models.TaskLabel{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN (?)", tasks).Delete(&models.ChecklistItem{}).Error; err != nil {
+		return err
+	}
+
+	sessions := tx.Model(&models.Session{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("session_id IN (?)", sessions).Delete(&models.RefreshToken{}).Error; err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{
+		&models.Task{},
+		&models.Project{},
+		&models.Label{},
+		&models.Reminder{},
+		&models.Notification{},
+		&models.WorkflowTransition{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.APIToken{},
+	} {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	// Throttle state and lockout records are keyed by email and contain personal data too
+	keys := []string{accountThrottleKey(user.Email), mfaThrottleKey(user.ID)}
+	if err := tx.Where("key IN ?", keys).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("key IN ? OR email = ?", keys, user.Email).Delete(&models.Lockout{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Delete(user).Error
+}
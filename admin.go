@@ -0,0 +1,392 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	adminDefaultPageSize = 50
+	adminMaxPageSize     = 200
+)
+
+// RoleRequest is the body for creating or updating a custom role.
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// AssignRoleRequest is the body of PUT /api/admin/users/:id/role.
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// RoleResponse is a role with its permissions expanded.
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"built_in"`
+}
+
+// adminTargetUser loads the user addressed by the :id route parameter.
+func adminTargetUser(c *gin.Context) (*models.User, bool) {
+	user := &models.User{}
+	if err := db.Where("id = ?", c.Param("id")).First(user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			log.Println("Error fetching user:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func AdminListUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(adminDefaultPageSize)))
+	if limit <= 0 || limit > adminMaxPageSize {
+		limit = adminDefaultPageSize
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	query := db.Model(&models.User{})
+	if c.Query("status") == "deleted" {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", like, like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "active":
+		query = query.Where("disabled_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Println("Error counting users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("created_at DESC").Limit(limit).Offset((page - 1) * limit).Find(&users).Error; err != nil {
+		log.Println("Error fetching users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users, "total": total, "page": page, "limit": limit})
+}
+
+func AdminGetUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func AdminDisableUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == middleware.CurrentUser(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot disable your own account"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		log.Println("Error disabling user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable user"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "disabled user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "user disabled"})
+}
+
+func AdminEnableUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(user).Update("disabled_at", nil).Error; err != nil {
+		log.Println("Error enabling user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable user"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "enabled user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "user enabled"})
+}
+
+// AdminDeleteUser soft-deletes an account. It can be restored until the
+// trash purger deletes it for good.
+func AdminDeleteUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == middleware.CurrentUser(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot delete your own account here"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		log.Println("Error deleting user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "deleted user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted", "purge_at": time.Now().Add(trashRetention)})
+}
+
+func AdminRestoreUser(c *gin.Context) {
+	user := &models.User{}
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted user not found"})
+		} else {
+			log.Println("Error fetching user:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		}
+		return
+	}
+
+	if err := db.Unscoped().Model(user).Update("deleted_at", nil).Error; err != nil {
+		log.Println("Error restoring user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore user"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "restored user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "user restored"})
+}
+
+func AdminLogoutUser(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeUserSessions(db, user.ID); err != nil {
+		log.Println("Error revoking sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out user"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "logged out user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "user logged out of all sessions"})
+}
+
+func AdminResetMFA(c *gin.Context) {
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return resetMFA(tx, user.ID)
+	}); err != nil {
+		log.Println("Error resetting MFA:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset two-factor authentication"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "reset MFA of user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication reset"})
+}
+
+func AdminAssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := adminTargetUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == middleware.CurrentUser(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot change your own role"})
+		return
+	}
+
+	exists, err := roleExists(req.Role)
+	if err != nil {
+		log.Println("Error checking role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign role"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + req.Role})
+		return
+	}
+
+	if err := db.Model(user).Update("role", req.Role).Error; err != nil {
+		log.Println("Error assigning role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to assign role"})
+		return
+	}
+
+	log.Println("admin", middleware.CurrentUser(c).ID, "assigned role", req.Role, "to user", user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "role assigned"})
+}
+
+func AdminListRoles(c *gin.Context) {
+	roles := []RoleResponse{
+		{Name: models.RoleUser, Permissions: models.BuiltInRoles[models.RoleUser], BuiltIn: true},
+		{Name: models.RoleAdmin, Permissions: models.BuiltInRoles[models.RoleAdmin], BuiltIn: true},
+	}
+
+	var custom []models.Role
+	if err := db.Order("name").Find(&custom).Error; err != nil {
+		log.Println("Error fetching roles:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roles"})
+		return
+	}
+	for _, role := range custom {
+		roles = append(roles, RoleResponse{Name: role.Name, Permissions: role.PermissionList()})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": roles, "permissions": models.Permissions})
+}
+
+// validateRoleRequest checks the permissions of a custom role.
+func validateRoleRequest(c *gin.Context, req *RoleRequest) bool {
+	if _, ok := models.BuiltInRoles[req.Name]; ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "built-in roles cannot be changed"})
+		return false
+	}
+	for _, permission := range req.Permissions {
+		if !validPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission " + permission, "allowed_permissions": models.Permissions})
+			return false
+		}
+	}
+	return true
+}
+
+func AdminCreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateRoleRequest(c, &req) {
+		return
+	}
+
+	exists, err := roleExists(req.Name)
+	if err != nil {
+		log.Println("Error checking role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create role"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "role already exists"})
+		return
+	}
+
+	role := models.Role{ID: uuid.New(), Name: req.Name, Permissions: strings.Join(req.Permissions, " ")}
+	if err := db.Create(&role).Error; err != nil {
+		log.Println("Error creating role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create role"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, RoleResponse{Name: role.Name, Permissions: role.PermissionList()})
+}
+
+func AdminUpdateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != c.Param("name") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "roles cannot be renamed"})
+		return
+	}
+	if !validateRoleRequest(c, &req) {
+		return
+	}
+
+	result := db.Model(&models.Role{}).Where("name = ?", req.Name).Update("permissions", strings.Join(req.Permissions, " "))
+	if result.Error != nil {
+		log.Println("Error updating role:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RoleResponse{Name: req.Name, Permissions: req.Permissions})
+}
+
+func AdminDeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := models.BuiltInRoles[name]; ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "built-in roles cannot be deleted"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("name = ?", name).Delete(&models.Role{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// Users of the deleted role fall back to a regular user
+		return tx.Model(&models.User{}).Where("role = ?", name).Update("role", models.RoleUser).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+		return
+	} else if err != nil {
+		log.Println("Error deleting role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiTokenPrefix tells API tokens apart from JWTs and makes leaked tokens easy to scan for.
+	apiTokenPrefix = "tm_pat_"
+	// apiTokenTouchInterval limits how often last_used_at is written.
+	apiTokenTouchInterval = time.Minute
+)
+
+var errInvalidAPIToken = errors.New("invalid api token")
+
+// CreateAPITokenRequest is the body of POST /api/tokens.
+type CreateAPITokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresInDays is optional; zero means the token never expires.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// APITokenResponse is a token as shown to its owner, with scopes expanded.
+type APITokenResponse struct {
+	*models.APIToken
+	Scopes []string `json:"scopes"`
+	// Token is only set right after creation.
+	Token string `json:"token,omitempty"`
+}
+
+func newAPITokenResponse(token *models.APIToken) APITokenResponse {
+	return APITokenResponse{APIToken: token, Scopes: token.ScopeList()}
+}
+
+// validAPIScope reports whether scope can be granted to an API token.
+func validAPIScope(scope string) bool {
+	for _, s := range models.APIScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIToken resolves a personal access token to its owner.
+func authenticateAPIToken(tokenString string) (*middleware.Auth, error) {
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", hashToken(tokenString)).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidAPIToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, errInvalidAPIToken
+	}
+
+	user := &models.User{}
+	if err := db.Where("id = ?", token.UserID).First(user).Error; err != nil {
+		return nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := db.Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+			log.Println("Error updating API token last use:", err)
+		}
+	}
+
+	return newAuth(user, uuid.Nil, token.ScopeList())
+}
+
+func ListAPITokens(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var tokens []models.APIToken
+	if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		log.Println("Error fetching API tokens:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tokens"})
+		return
+	}
+
+	data := make([]APITokenResponse, 0, len(tokens))
+	for i := range tokens {
+		data = append(data, newAPITokenResponse(&tokens[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+func CreateAPIToken(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !validAPIScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope, "allowed_scopes": models.APIScopes})
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must not be negative"})
+		return
+	}
+
+	secret, err := generateRandomToken()
+	if err != nil {
+		log.Println("Error generating API token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	raw := apiTokenPrefix + secret
+
+	token := models.APIToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    raw[:len(apiTokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    strings.Join(req.Scopes, " "),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := db.Create(&token).Error; err != nil {
+		log.Println("Error creating API token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	// The raw token is only ever shown in this response
+	response := newAPITokenResponse(&token)
+	response.Token = raw
+	c.JSON(http.StatusCreated, response)
+}
+
+func RevokeAPIToken(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	result := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		log.Println("Error revoking API token:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
@@ -0,0 +1,78 @@
+// Command keys manages the JWT signing keys of the task manager.
+//
+// Usage:
+//
+//	go run ./cmd/keys [-dir keys] generate [-alg RS256|EdDSA]
+//	go run ./cmd/keys [-dir keys] rotate [-alg RS256|EdDSA]
+//	go run ./cmd/keys [-dir keys] list
+//	go run ./cmd/keys [-dir keys] remove <kid>
+//
+// Rotating adds a new active key and keeps the previous keys for
+// verification only, so tokens issued before stay valid. Send SIGHUP to the
+// server (or restart it) to pick up the new key.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"task-manager-app/keyring"
+)
+
+func main() {
+	defaultDir := os.Getenv("KEYS_DIR")
+	if defaultDir == "" {
+		defaultDir = "keys"
+	}
+	dir := flag.String("dir", defaultDir, "directory holding the signing keys")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "generate", "rotate":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		alg := fs.String("alg", keyring.RS256, "signing algorithm: RS256 or EdDSA")
+		fs.Parse(args)
+
+		kid, err := keyring.Generate(*dir, *alg)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println("new active key:", kid)
+	case "list":
+		ring, err := keyring.Load(*dir)
+		if err != nil {
+			fail(err)
+		}
+		for _, key := range ring.Keys() {
+			status := "verify-only"
+			if key.ID == ring.ActiveID() {
+				status = "active"
+			}
+			fmt.Printf("%s\t%s\t%s\n", key.ID, key.Algorithm, status)
+		}
+	case "remove":
+		if len(args) != 1 {
+			usage()
+		}
+		if err := keyring.Remove(*dir, args[0]); err != nil {
+			fail(err)
+		}
+		fmt.Println("removed key:", args[0])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keys [-dir keys] generate|rotate [-alg RS256|EdDSA] | list | remove <kid>")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"task-manager-app/mailer"
+	"task-manager-app/models"
+	"task-manager-app/render"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Policies for logging in with an unverified email address.
+const (
+	UnverifiedAllow string = "allow"
+	UnverifiedWarn  string = "warn"
+	UnverifiedBlock string = "block"
+)
+
+// maxTokenEmailsPerHour caps how many emails with a link of one purpose an account can request.
+const maxTokenEmailsPerHour = 5
+
+// ResendVerificationRequest is the body of POST /verify-email/resend.
+type ResendVerificationRequest struct {
+	Email string `json:"email" form:"email" binding:"required"`
+}
+
+// sendVerificationEmail issues a new verification token for the user and mails the link.
+func sendVerificationEmail(user *models.User) error {
+	token, err := issueUserToken(user.ID, models.PurposeEmailVerification, "", emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appURL + "/verify-email?token=" + url.QueryEscape(token)
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Please confirm your email address by opening the link below. It expires in " + emailVerificationTTL.String() + ".\n\n" +
+			link + "\n",
+	})
+}
+
+// tokenEmailRateLimited reports whether the user has recently asked for too
+// many emails with a link of the given purpose.
+func tokenEmailRateLimited(user *models.User, purpose string) (bool, error) {
+	var last models.UserToken
+	err := db.Where("user_id = ? AND purpose = ?", user.ID, purpose).
+		Order("created_at DESC").First(&last).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if time.Since(last.CreatedAt) < verificationResendInterval {
+		return true, nil
+	}
+
+	var count int64
+	if err := db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, purpose, time.Now().Add(-time.Hour)).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count >= maxTokenEmailsPerHour, nil
+}
+
+func VerifyEmail(c *gin.Context) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, c.Query("token"), models.PurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if err != nil {
+		if err != errInvalidUserToken {
+			log.Println("Error verifying email:", err)
+		}
+		render.RenderTemplate(c, "verify_email", gin.H{
+			"Success": false,
+			"Resend":  true,
+			"Message": "This verification link is invalid or has expired.",
+		})
+		return
+	}
+
+	render.RenderTemplate(c, "verify_email", gin.H{
+		"Success": true,
+		"Message": "Your email address has been verified.",
+	})
+}
+
+func ResendVerificationEmail(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	// Same answer for unknown and already verified addresses
+	response := gin.H{"message": "If this email needs verification, a new link has been sent."}
+
+	user, err := getUserByEmail(req.Email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	limited, err := tokenEmailRateLimited(user, models.PurposeEmailVerification)
+	if err != nil {
+		log.Println("Error checking verification rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+	// A different answer would tell that the account exists
+	if limited {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,355 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported signing algorithms.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// A key directory holds one "<kid>.key" file (PKCS#8 PEM) per key that can
+// still sign, one "<kid>.pub" file (PKIX PEM) per retired key that is only
+// kept to verify tokens issued before a rotation, and an "active" file naming
+// the key used for signing.
+const (
+	activeFile   = "active"
+	privateExt   = ".key"
+	publicExt    = ".pub"
+	rsaKeyBits   = 2048
+	kidTimestamp = "20060102150405"
+)
+
+var (
+	// ErrNoActiveKey is returned when the key directory has no signing key.
+	ErrNoActiveKey = errors.New("keyring has no active signing key")
+	errUnknownKey  = errors.New("unknown signing key")
+)
+
+// Key is a single signing or verification key.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// method returns the JWT signing method of the key.
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == EdDSA {
+		return SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Keyring holds the active signing key and the keys still accepted for
+// verification. It is safe for concurrent use and can be reloaded.
+type Keyring struct {
+	dir string
+
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+// Load reads all keys from dir.
+func Load(dir string) (*Keyring, error) {
+	k := &Keyring{dir: dir}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads the key directory, picking up rotations done by the CLI.
+func (k *Keyring) Reload() error {
+	keys, activeID, err := readDir(k.dir)
+	if err != nil {
+		return err
+	}
+
+	active, ok := keys[activeID]
+	if !ok || active.Private == nil {
+		return ErrNoActiveKey
+	}
+
+	k.mu.Lock()
+	k.keys, k.active = keys, active
+	k.mu.Unlock()
+	return nil
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(active.method(), claims)
+	token.Header["kid"] = active.ID
+	return token.SignedString(active.Private)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse. The
+// token's algorithm must match the key so keys cannot be used with another
+// algorithm than the one they were created for.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, errUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// Keys returns all keys, newest first.
+func (k *Keyring) Keys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys
+}
+
+// ActiveID returns the kid of the signing key.
+func (k *Keyring) ActiveID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active.ID
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys in the format served at /.well-known/jwks.json.
+func (k *Keyring) JWKS() map[string][]JWK {
+	keys := k.Keys()
+	set := make([]JWK, 0, len(keys))
+	for _, key := range keys {
+		jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set = append(set, jwk)
+	}
+	return map[string][]JWK{"keys": set}
+}
+
+// Generate creates a new key in dir and makes it the active signing key.
+// Every other key is demoted to verification-only by replacing its private
+// key file with the public key, so tokens signed before stay valid.
+func Generate(dir, algorithm string) (string, error) {
+	var signer crypto.Signer
+	switch algorithm {
+	case RS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", err
+		}
+		signer = key
+	case EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		signer = key
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	kid := time.Now().UTC().Format(kidTimestamp) + "-" + hex.EncodeToString(suffix)
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return "", err
+	}
+	if err := writePEM(filepath.Join(dir, kid+privateExt), "PRIVATE KEY", der, 0o600); err != nil {
+		return "", err
+	}
+
+	if err := demoteKeys(dir, kid); err != nil {
+		return "", err
+	}
+
+	// Switch the active key last, once everything else is in place
+	tmp := filepath.Join(dir, activeFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(kid+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, activeFile)); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+// Remove deletes a retired key so tokens signed with it are no longer accepted.
+func Remove(dir, kid string) error {
+	active, err := os.ReadFile(filepath.Join(dir, activeFile))
+	if err == nil && strings.TrimSpace(string(active)) == kid {
+		return errors.New("the active key cannot be removed, rotate first")
+	}
+	err = os.Remove(filepath.Join(dir, kid+publicExt))
+	if os.IsNotExist(err) {
+		return errUnknownKey
+	}
+	return err
+}
+
+// demoteKeys turns every private key except keep into a public key file.
+func demoteKeys(dir, keep string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, privateExt) || name == keep+privateExt {
+			continue
+		}
+		key, err := readKey(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalPKIXPublicKey(key.Public)
+		if err != nil {
+			return err
+		}
+		kid := strings.TrimSuffix(name, privateExt)
+		if err := writePEM(filepath.Join(dir, kid+publicExt), "PUBLIC KEY", der, 0o644); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDir(dir string) (map[string]*Key, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys := make(map[string]*Key)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, privateExt) && !strings.HasSuffix(name, publicExt) {
+			continue
+		}
+		key, err := readKey(filepath.Join(dir, name))
+		if err != nil {
+			return nil, "", fmt.Errorf("load key %s: %w", name, err)
+		}
+		keys[key.ID] = key
+	}
+
+	active, err := os.ReadFile(filepath.Join(dir, activeFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+	return keys, strings.TrimSpace(string(active)), nil
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	name := filepath.Base(path)
+	key := &Key{ID: strings.TrimSuffix(strings.TrimSuffix(name, privateExt), publicExt)}
+
+	var parsed interface{}
+	if strings.HasSuffix(name, privateExt) {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Private, key.Public = RS256, k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Private, key.Public = EdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = RS256, k
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = EdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
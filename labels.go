@@ -0,0 +1,432 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxLabelNameLength = 50
+	defaultLabelColor  = "#0d6efd"
+	// maxBulkLabelTasks caps how many tasks one bulk request may change.
+	maxBulkLabelTasks = 500
+)
+
+var (
+	errLabelNotFound = errors.New("label not found")
+	errLabelExists   = errors.New("label already exists")
+	errTaskNotFound  = errors.New("task not found")
+)
+
+// labelIndexes speed up finding the tasks of a label and keep label names
+// unique per user. Trashed labels do not hold on to their name.
+var labelIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_task_labels_label ON task_labels (label_id)",
+	"DROP INDEX IF EXISTS idx_labels_user_name",
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_labels_user_name_active ON labels (user_id, name) WHERE deleted_at IS NULL",
+}
+
+// LabelRequest is the body of POST /api/labels and PUT /api/labels/:id.
+// Fields left out are not changed.
+type LabelRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// MergeLabelRequest is the body of POST /api/labels/:id/merge.
+type MergeLabelRequest struct {
+	Into string `json:"into" binding:"required"`
+}
+
+// BulkLabelRequest is the body of POST /api/tasks/labels. Labels in Add are
+// put on every task, labels in Remove are taken off.
+type BulkLabelRequest struct {
+	TaskIDs []string `json:"task_ids" binding:"required"`
+	Add     []string `json:"add"`
+	Remove  []string `json:"remove"`
+}
+
+// findLabel loads a label of the user, failing with errLabelNotFound for
+// unknown IDs and labels of other users.
+func findLabel(tx *gorm.DB, userID uuid.UUID, id string) (*models.Label, error) {
+	labelID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errLabelNotFound
+	}
+
+	var label models.Label
+	if err := tx.Where("id = ? AND user_id = ?", labelID, userID).First(&label).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errLabelNotFound
+		}
+		return nil, err
+	}
+	return &label, nil
+}
+
+// labelNameTaken reports whether another label of the user has the name,
+// ignoring case.
+func labelNameTaken(tx *gorm.DB, userID uuid.UUID, name string, except uuid.UUID) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Label{}).
+		Where("user_id = ? AND lower(name) = lower(?) AND id <> ?", userID, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ownedIDs parses the IDs and checks that every one of them belongs to a row
+// of the user in the model's table.
+func ownedIDs(tx *gorm.DB, model interface{}, userID uuid.UUID, values []string, notFound error) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	seen := map[uuid.UUID]bool{}
+	for _, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, notFound
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	var count int64
+	if err := tx.Model(model).Where("user_id = ? AND id IN ?", userID, ids).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(ids) {
+		return nil, notFound
+	}
+	return ids, nil
+}
+
+// applyLabelRequest validates the request and copies it onto the label. It
+// returns a message for each invalid field.
+func applyLabelRequest(label *models.Label, req *LabelRequest) map[string]string {
+	fieldErrors := map[string]string{}
+
+	if req.Name != nil {
+		label.Name = strings.TrimSpace(*req.Name)
+	}
+	if label.Name == "" {
+		fieldErrors["name"] = "name is required"
+	} else if len(label.Name) > maxLabelNameLength {
+		fieldErrors["name"] = "name is too long"
+	}
+	if req.Color != nil {
+		if !colorPattern.MatchString(*req.Color) {
+			fieldErrors["color"] = "color must look like #1a2b3c"
+		}
+		label.Color = strings.ToLower(*req.Color)
+	}
+
+	return fieldErrors
+}
+
+// resolveLabels maps the filter values, IDs or names ignoring case, to the
+// IDs of the user's labels among labels. It also reports whether every value
+// named one of them.
+func resolveLabels(values []string, labels []models.Label) ([]uuid.UUID, bool) {
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	complete := true
+	for _, value := range values {
+		found := false
+		for _, label := range labels {
+			if label.ID.String() == strings.ToLower(value) || strings.EqualFold(label.Name, value) {
+				found = true
+				if !seen[label.ID] {
+					seen[label.ID] = true
+					ids = append(ids, label.ID)
+				}
+			}
+		}
+		complete = complete && found
+	}
+	return ids, complete
+}
+
+// applyLabelFilter keeps tasks carrying the labels, given as IDs or names.
+// With matchAll a task needs every label, so a label the user does not have
+// matches no task. Otherwise any one of the labels is enough.
+func applyLabelFilter(query *gorm.DB, userID uuid.UUID, values []string, matchAll bool) (*gorm.DB, error) {
+	var ids []uuid.UUID
+	var names []string
+	for _, value := range values {
+		if id, err := uuid.Parse(value); err == nil {
+			ids = append(ids, id)
+		} else {
+			names = append(names, strings.ToLower(value))
+		}
+	}
+	// IN () is invalid SQL, use values that never match
+	if len(ids) == 0 {
+		ids = []uuid.UUID{uuid.Nil}
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var labels []models.Label
+	if err := db.Where("user_id = ? AND (id IN ? OR lower(name) IN ?)", userID, ids, names).Find(&labels).Error; err != nil {
+		return nil, err
+	}
+	labelIDs, complete := resolveLabels(values, labels)
+	if len(labelIDs) == 0 || (matchAll && !complete) {
+		return query.Where("1 = 0"), nil
+	}
+
+	matching := db.Table("task_labels").Select("task_id").Where("label_id IN ?", labelIDs)
+	if matchAll {
+		matching = matching.Group("task_id").Having("COUNT(DISTINCT label_id) = ?", len(labelIDs))
+	}
+	return query.Where("id IN (?)", matching), nil
+}
+
+func ListLabels(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var labels []models.Label
+	if err := db.Where("user_id = ?", user.ID).Order("lower(name)").Find(&labels).Error; err != nil {
+		log.Println("Error fetching labels:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve labels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": labels})
+}
+
+func CreateLabel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	label := models.Label{ID: uuid.New(), UserID: user.ID, Color: defaultLabelColor}
+	if fieldErrors := applyLabelRequest(&label, &req); len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid label", "errors": fieldErrors})
+		return
+	}
+
+	taken, err := labelNameTaken(db, user.ID, label.Name, label.ID)
+	if err != nil {
+		log.Println("Error checking label name:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create label"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "a label with this name already exists"})
+		return
+	}
+
+	if err := db.Create(&label).Error; err != nil {
+		log.Println("Error creating label:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create label"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, label)
+}
+
+// UpdateLabel renames or recolors a label. Tasks refer to the label by ID,
+// so they all see the change at once.
+func UpdateLabel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	var label *models.Label
+	var fieldErrors map[string]string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		label, err = findLabel(tx.Clauses(clause.Locking{Strength: "UPDATE"}), user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		if fieldErrors = applyLabelRequest(label, &req); len(fieldErrors) > 0 {
+			return nil
+		}
+
+		taken, err := labelNameTaken(tx, user.ID, label.Name, label.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errLabelExists
+		}
+		return tx.Save(label).Error
+	})
+	if err == errLabelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "label not found"})
+		return
+	} else if err == errLabelExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "a label with this name already exists, merge the labels instead"})
+		return
+	} else if err != nil {
+		log.Println("Error updating label:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update label"})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid label", "errors": fieldErrors})
+		return
+	}
+
+	c.JSON(http.StatusOK, label)
+}
+
+func DeleteLabel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		label, err := findLabel(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		// The tasks keep the label while it is in the trash
+		return tx.Delete(label).Error
+	})
+	if err == errLabelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "label not found"})
+		return
+	} else if err != nil {
+		log.Println("Error deleting label:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete label"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "label moved to the trash"})
+}
+
+// MergeLabel moves every task of a label to another label and deletes it, in
+// one transaction.
+func MergeLabel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req MergeLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "into is required"})
+		return
+	}
+
+	var target *models.Label
+	err := db.Transaction(func(tx *gorm.DB) error {
+		source, err := findLabel(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		target, err = findLabel(tx, user.ID, req.Into)
+		if err != nil {
+			return err
+		}
+		if source.ID == target.ID {
+			return errLabelExists
+		}
+
+		// Tasks that already carry the target keep a single association
+		if err := tx.Exec(`INSERT INTO task_labels (task_id, label_id)
+			SELECT task_id, ? FROM task_labels WHERE label_id = ?
+			ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("label_id = ?", source.ID).Delete(&models.TaskLabel{}).Error; err != nil {
+			return err
+		}
+		// A merged label has no tasks left, there is nothing to restore
+		return tx.Unscoped().Delete(source).Error
+	})
+	if err == errLabelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "label not found"})
+		return
+	} else if err == errLabelExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a label cannot be merged into itself"})
+		return
+	} else if err != nil {
+		log.Println("Error merging labels:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to merge labels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// BulkLabelTasks attaches and detaches labels on many tasks at once.
+func BulkLabelTasks(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req BulkLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "task_ids is required"})
+		return
+	}
+	if len(req.TaskIDs) == 0 || len(req.TaskIDs) > maxBulkLabelTasks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "task_ids must list between 1 and 500 tasks"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		taskIDs, err := ownedIDs(tx, &models.Task{}, user.ID, req.TaskIDs, errTaskNotFound)
+		if err != nil {
+			return err
+		}
+		add, err := ownedIDs(tx, &models.Label{}, user.ID, req.Add, errLabelNotFound)
+		if err != nil {
+			return err
+		}
+		remove, err := ownedIDs(tx, &models.Label{}, user.ID, req.Remove, errLabelNotFound)
+		if err != nil {
+			return err
+		}
+
+		if len(remove) > 0 {
+			if err := tx.Where("task_id IN ? AND label_id IN ?", taskIDs, remove).
+				Delete(&models.TaskLabel{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(add) > 0 {
+			rows := make([]models.TaskLabel, 0, len(taskIDs)*len(add))
+			for _, taskID := range taskIDs {
+				for _, labelID := range add {
+					rows = append(rows, models.TaskLabel{TaskID: taskID, LabelID: labelID})
+				}
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err == errLabelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "label not found"})
+		return
+	} else if err != nil {
+		log.Println("Error labelling tasks:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update labels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "labels updated"})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"task-manager-app/models"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestResolveLabels(t *testing.T) {
+	home := models.Label{ID: uuid.New(), Name: "Home"}
+	work := models.Label{ID: uuid.New(), Name: "work"}
+	labels := []models.Label{home, work}
+
+	tests := []struct {
+		name         string
+		values       []string
+		wantIDs      []uuid.UUID
+		wantComplete bool
+	}{
+		{"names ignoring case", []string{"home", "WORK"}, []uuid.UUID{home.ID, work.ID}, true},
+		{"id", []string{home.ID.String()}, []uuid.UUID{home.ID}, true},
+		{"name and id of the same label", []string{"home", home.ID.String()}, []uuid.UUID{home.ID}, true},
+		{"unknown name", []string{"home", "nonexistent"}, []uuid.UUID{home.ID}, false},
+		{"unknown id", []string{uuid.NewString()}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, complete := resolveLabels(tt.values, labels)
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyLabelFilterMatchAllUnknownLabel(t *testing.T) {
+	mock := mockDB(t)
+	userID := uuid.New()
+	mock.ExpectQuery(`SELECT \* FROM "labels"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).AddRow(uuid.New(), userID, "home"))
+	mock.ExpectQuery(`SELECT \* FROM "tasks" WHERE user_id = \$1 AND 1 = 0`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	query, err := applyLabelFilter(db.Where("user_id = ?", userID), userID, []string{"home", "nonexistent"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tasks []models.Task
+	if err := query.Find(&tasks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 {
+		t.Errorf("got %d tasks, want none", len(tasks))
+	}
+}
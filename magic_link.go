@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"task-manager-app/mailer"
+	"task-manager-app/models"
+	"task-manager-app/render"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MagicLinkRequest is the body of POST /login/magic.
+type MagicLinkRequest struct {
+	Email string `json:"email" form:"email" binding:"required"`
+}
+
+// MagicLinkLoginRequest is the body of POST /login/magic/callback.
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+func RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	// Same answer whether or not the account exists
+	response := gin.H{"message": "If an account exists for this email, a login link has been sent."}
+
+	user, err := getUserByEmail(req.Email)
+	if err != nil || user.DisabledAt != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	limited, err := tokenEmailRateLimited(user, models.PurposeMagicLogin)
+	if err != nil {
+		log.Println("Error checking magic link rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+	// A different answer would tell that the account exists
+	if limited {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := issueUserToken(user.ID, models.PurposeMagicLogin, "", magicLinkTTL)
+	if err != nil {
+		log.Println("Error creating magic link token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+
+	link := appURL + "/login/magic/callback?token=" + url.QueryEscape(token)
+	if err := mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Open the link below to log in. It can be used once and expires in " + magicLinkTTL.String() + ".\n\n" +
+			link + "\n\n" +
+			"If you did not ask to log in you can ignore this email.\n",
+	}); err != nil {
+		log.Println("Error sending magic link email:", err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MagicLinkPage only shows a confirmation button. Mail scanners and link
+// previews fetch the URL with GET, so the token is not redeemed until the
+// user posts it back.
+func MagicLinkPage(c *gin.Context) {
+	// Keep the token out of caches and Referer headers
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	render.RenderTemplate(c, "magic_login", gin.H{"Token": c.Query("token")})
+}
+
+func MagicLinkLogin(c *gin.Context) {
+	var req MagicLinkLoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, req.Token, models.PurposeMagicLogin)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", record.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if user.DisabledAt != nil {
+			return errAccountDisabled
+		}
+
+		// Opening the link proves the user owns the address
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		}
+		return nil
+	})
+	if err == errInvalidUserToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": "This login link is invalid or has expired."})
+		return
+	} else if err == errAccountDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "error": "Your account has been disabled."})
+		return
+	} else if err != nil {
+		log.Println("Error redeeming magic link:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+
+	// The link replaces the password, not the second factor
+	if user.MFAEnabledAt != nil {
+		challenge, err := generateMFAChallenge(user.ID)
+		if err != nil {
+			log.Println("Error generating MFA challenge:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to generate JWT token."})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge})
+		return
+	}
+
+	pair, err := createSession(c, user.ID)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to generate JWT token."})
+		return
+	}
+
+	setSessionCookies(c, pair)
+	c.JSON(http.StatusOK, pair)
+}
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewFromEnv builds the mailer selected by the MAILER environment variable:
+// "smtp" for real delivery, anything else for the local file/log mailer.
+func NewFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	if os.Getenv("MAILER") == "smtp" {
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+
+	return &FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+}
+
+// format renders the message with the headers expected by mail servers.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerValue(from) + "\r\n")
+	b.WriteString("To: " + headerValue(msg.To) + "\r\n")
+	b.WriteString("Subject: " + headerValue(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so values cannot inject extra headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := m.Host + ":" + m.Port
+	if err := smtp.SendMail(addr, auth, m.From, []string{msg.To}, format(m.From, msg)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// FileMailer is meant for local development and tests. It writes every email
+// to a file in Dir, or to the log when Dir is empty.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data := format(m.From, msg)
+	if m.Dir == "" {
+		log.Printf("mail to %s:\n%s\n", msg.To, data)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
+
+// sanitize makes an email address safe to use in a file name.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -4,9 +4,13 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	netmail "net/mail"
 	"os"
+	"strconv"
 	"strings"
 	"task-manager-app/database"
+	"task-manager-app/mailer"
+	"task-manager-app/middleware"
 	"task-manager-app/models"
 	"task-manager-app/render"
 	"time"
@@ -20,8 +24,26 @@ import (
 )
 
 var (
-	db        *gorm.DB
-	jwtSecret []byte
+	db               *gorm.DB
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	passwordResetTTL time.Duration
+	magicLinkTTL     time.Duration
+	// Email verification settings
+	emailVerificationTTL       time.Duration
+	verificationResendInterval time.Duration
+	unverifiedLoginPolicy      string
+	mfaIssuer                  string
+	// How recent a login must be to confirm changes without a password
+	recentLoginWindow time.Duration
+	// Brute-force protection settings
+	loginLockoutThreshold int
+	loginLockoutDuration  time.Duration
+	appURL                string
+	// Trash settings
+	trashRetention     time.Duration
+	trashPurgeInterval time.Duration
+	mail               mailer.Mailer
 )
 
 // Define a struct for the login request data
@@ -32,24 +54,128 @@ type LoginRequest struct {
 
 // CustomClaims represents custom claims in the JWT token.
 type CustomClaims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	SessionID uuid.UUID `json:"sid"`
 	// Add other claims as needed
 	jwt.StandardClaims
 }
 
-func init() {
+// loadConfig reads the configuration from the environment. It runs first in
+// main, not in init, so tests of this package do not need a .env file.
+func loadConfig() {
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
 		panic("Error loading .env file")
 	}
 
-	// Get the JWT secret key from the environment variables
-	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+	// Keys used to sign and verify JWTs
+	loadSigningKeys()
+
+	// Lifetimes of access and refresh tokens
+	accessTokenTTL = durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	refreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	passwordResetTTL = durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+	magicLinkTTL = durationFromEnv("MAGIC_LINK_TTL", 15*time.Minute)
+	emailVerificationTTL = durationFromEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	verificationResendInterval = durationFromEnv("VERIFICATION_RESEND_INTERVAL", time.Minute)
+
+	// What happens when an unverified user logs in: allow, warn or block
+	unverifiedLoginPolicy = os.Getenv("UNVERIFIED_LOGIN_POLICY")
+	if unverifiedLoginPolicy == "" {
+		unverifiedLoginPolicy = UnverifiedWarn
+	}
+
+	// Failed logins before an account is locked, and for how long
+	loginLockoutThreshold = 10
+	if value, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD")); err == nil && value > 0 {
+		loginLockoutThreshold = value
+	}
+	loginLockoutDuration = durationFromEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+
+	// How long deleted tasks, projects, labels and users stay in the trash, and how often it is purged
+	trashRetention = durationFromEnv("TRASH_RETENTION", 30*24*time.Hour)
+	trashPurgeInterval = durationFromEnv("TRASH_PURGE_INTERVAL", time.Hour)
+
+	// Accounts without a password, such as ones created through SSO, confirm
+	// sensitive changes by having logged in this recently
+	recentLoginWindow = durationFromEnv("RECENT_LOGIN_WINDOW", 10*time.Minute)
+
+	// Name shown for this app in authenticator apps
+	mfaIssuer = os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "Task Manager"
+	}
+
+	// Public base URL used in links sent by email
+	appURL = strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+
+	// SMTP in production, file/log mailer for local development
+	mail = mailer.NewFromEnv()
+
+	// External identity providers for single sign-on
+	setupOIDCProviders()
+
+	// Rules for new passwords and the bcrypt cost
+	setupPasswordPolicy()
+}
+
+// durationFromEnv reads a duration such as "15m" from the environment,
+// falling back to def when the variable is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Println("invalid duration for "+key+":", err)
+		return def
+	}
+	return d
+}
+
+// intFromEnv reads a number from the environment, falling back to def when
+// the variable is unset or invalid.
+func intFromEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Println("invalid number for "+key+":", err)
+		return def
+	}
+	return n
+}
+
+// migrateSchema runs the statements AutoMigrate cannot express, such as
+// expression indexes and generated columns. Each one must be idempotent.
+func migrateSchema(db *gorm.DB) error {
+	var statements []string
+	statements = append(statements, softDeleteMigrations...)
+	statements = append(statements, taskIndexes...)
+	statements = append(statements, taskSearchMigrations...)
+	statements = append(statements, projectIndexes...)
+	statements = append(statements, labelIndexes...)
+	statements = append(statements, reminderIndexes...)
+	statements = append(statements, taskStatusMigrations...)
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func main() {
+	loadConfig()
+
 	// Setup the database
 	DB, err := database.SetupDatabase()
 	if err != nil {
@@ -57,23 +183,133 @@ func main() {
 	}
 	db = DB
 	// Auto Migrate the Task model
-	DB.AutoMigrate(&models.User{}, &models.Task{})
+	DB.AutoMigrate(&models.User{}, &models.Task{}, &models.Session{}, &models.RefreshToken{}, &models.UserToken{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.APIToken{}, &models.Role{}, &models.LoginThrottle{}, &models.Lockout{}, &models.Project{}, &models.Label{}, &models.ChecklistItem{}, &models.Reminder{}, &models.Notification{}, &models.WorkflowTransition{})
+	if err := migrateSchema(DB); err != nil {
+		log.Println("Error migrating database:", err)
+	}
+	promoteAdmins()
+	startTrashPurger(trashPurgeInterval)
+
+	// Reminders are delivered by every replica, each claims its own batch
+	setupNotifiers()
+	startReminderScheduler(reminderPollInterval)
+
+	reloadSigningKeysOnSignal()
 
 	r := gin.Default()
 	r.Static("/static", "./static")
 
 	// Routes
 	r.GET("/", HomePage)
+	r.GET("/.well-known/jwks.json", JWKS)
 	r.GET("/register", RegisterPage)
 	r.GET("/login", LoginPage)
 	r.POST("/register", Register)
 	r.POST("/login", Login)
+	r.POST("/login/mfa", LoginMFA)
+	r.POST("/login/magic", RequestMagicLink)
+	r.GET("/login/magic/callback", MagicLinkPage)
+	r.POST("/login/magic/callback", MagicLinkLogin)
+	r.POST("/auth/refresh", RefreshSession)
+	r.GET("/auth/oidc/login", OIDCLogin)
+	r.GET("/auth/oidc/callback", OIDCCallback)
+	r.POST("/logout", Logout)
 	r.GET("/todo", TodoPage)
-	r.GET("/profile", GetCurrentUser)
-	r.GET("/tasks", GetAllTasks)
-	r.POST("/task/create", CreateTask)
-	r.PUT("/task/update/:id", UpdateTask)
-	r.DELETE("/task/delete/:id", DeleteTask)
+	r.GET("/security", SecurityPage)
+	r.GET("/password/forgot", ForgotPasswordPage)
+	r.POST("/password/forgot", ForgotPassword)
+	r.GET("/password/reset", ResetPasswordPage)
+	r.POST("/password/reset", ResetPassword)
+	r.GET("/verify-email", VerifyEmail)
+	r.GET("/profile/email/confirm", ConfirmEmailChange)
+	r.POST("/verify-email/resend", ResendVerificationEmail)
+
+	// Routes that require an authenticated user
+	authRequired := middleware.AuthMiddleware(authenticateToken)
+	sessionRequired := middleware.RequireSession()
+	r.POST("/logout-all", authRequired, sessionRequired, LogoutAll)
+
+	api := r.Group("/api", authRequired)
+	api.GET("/profile", middleware.RequireScope(models.ScopeProfileRead), GetCurrentUser)
+
+	readTasks := middleware.RequireScope(models.ScopeTasksRead)
+	writeTasks := middleware.RequireScope(models.ScopeTasksWrite)
+	api.GET("/tasks", readTasks, GetAllTasks)
+	api.GET("/search", readTasks, SearchTasks)
+	api.GET("/projects", readTasks, ListProjects)
+	api.GET("/projects/:id", readTasks, GetProject)
+	api.GET("/projects/:id/tasks", readTasks, ListProjectTasks)
+	api.POST("/projects", writeTasks, CreateProject)
+	api.PUT("/projects/:id", writeTasks, UpdateProject)
+	api.DELETE("/projects/:id", writeTasks, DeleteProject)
+	api.POST("/projects/:id/restore", writeTasks, RestoreProject)
+	api.GET("/workflow", readTasks, GetWorkflow)
+	api.PUT("/workflow", writeTasks, UpdateWorkflow)
+	api.DELETE("/workflow", writeTasks, ResetWorkflow)
+	api.GET("/labels", readTasks, ListLabels)
+	api.POST("/labels", writeTasks, CreateLabel)
+	api.PUT("/labels/:id", writeTasks, UpdateLabel)
+	api.DELETE("/labels/:id", writeTasks, DeleteLabel)
+	api.POST("/labels/:id/restore", writeTasks, RestoreLabel)
+	api.POST("/labels/:id/merge", writeTasks, MergeLabel)
+	api.POST("/tasks/labels", writeTasks, BulkLabelTasks)
+	api.GET("/tasks/:id", readTasks, GetTask)
+	api.GET("/tasks/:id/subtasks", readTasks, ListSubtasks)
+	api.POST("/tasks", writeTasks, CreateTask)
+	api.PUT("/tasks/:id", writeTasks, UpdateTask)
+	api.DELETE("/tasks/:id", writeTasks, DeleteTask)
+	api.GET("/trash", readTasks, ListTrash)
+	api.DELETE("/trash", writeTasks, EmptyTrash)
+	api.DELETE("/trash/tasks/:id", writeTasks, PurgeTrashedTask)
+	api.POST("/tasks/:id/restore", writeTasks, RestoreTask)
+	api.POST("/tasks/:id/skip", writeTasks, SkipOccurrence)
+	api.POST("/tasks/:id/end-series", writeTasks, EndSeries)
+	api.GET("/tasks/:id/reminders", readTasks, ListReminders)
+	api.POST("/tasks/:id/reminders", writeTasks, CreateReminder)
+	api.DELETE("/tasks/:id/reminders/:reminder", writeTasks, DeleteReminder)
+	api.GET("/notifications", readTasks, ListNotifications)
+	api.POST("/notifications/:id/read", writeTasks, MarkNotificationRead)
+	api.POST("/tasks/:id/checklist", writeTasks, CreateChecklistItem)
+	api.PUT("/tasks/:id/checklist/:item", writeTasks, UpdateChecklistItem)
+	api.DELETE("/tasks/:id/checklist/:item", writeTasks, DeleteChecklistItem)
+
+	// Account management is only available to login sessions
+	account := api.Group("", sessionRequired)
+	account.POST("/mfa/enroll", EnrollMFA)
+	account.POST("/mfa/confirm", ConfirmMFA)
+	account.POST("/mfa/disable", DisableMFA)
+	account.POST("/mfa/recovery-codes", RegenerateRecoveryCodes)
+	account.PATCH("/profile", UpdateProfile)
+	account.POST("/profile/password", ChangePassword)
+	account.POST("/profile/email", RequestEmailChange)
+	account.GET("/sessions", ListSessions)
+	account.DELETE("/sessions/:id", DeleteSession)
+	account.GET("/tokens", ListAPITokens)
+	account.POST("/tokens", CreateAPIToken)
+	account.DELETE("/tokens/:id", RevokeAPIToken)
+	account.POST("/account/export", ExportAccountData)
+	account.POST("/account/delete", DeleteAccount)
+
+	// Admin API, permissions are checked per route
+	usersRead := middleware.RequirePermission(models.PermUsersRead)
+	usersManage := middleware.RequirePermission(models.PermUsersManage)
+	rolesManage := middleware.RequirePermission(models.PermRolesManage)
+	admin := api.Group("/admin", sessionRequired)
+	admin.GET("/users", usersRead, AdminListUsers)
+	admin.GET("/users/:id", usersRead, AdminGetUser)
+	admin.POST("/users/:id/disable", usersManage, AdminDisableUser)
+	admin.POST("/users/:id/enable", usersManage, AdminEnableUser)
+	admin.POST("/users/:id/logout", usersManage, AdminLogoutUser)
+	admin.DELETE("/users/:id", usersManage, AdminDeleteUser)
+	admin.POST("/users/:id/restore", usersManage, AdminRestoreUser)
+	admin.POST("/users/:id/mfa/reset", usersManage, AdminResetMFA)
+	admin.PUT("/users/:id/role", rolesManage, AdminAssignRole)
+	admin.GET("/roles", rolesManage, AdminListRoles)
+	admin.POST("/roles", rolesManage, AdminCreateRole)
+	admin.PUT("/roles/:name", rolesManage, AdminUpdateRole)
+	admin.DELETE("/roles/:name", rolesManage, AdminDeleteRole)
+	admin.GET("/lockouts", usersRead, AdminListLockouts)
+	admin.POST("/lockouts/:id/clear", usersManage, AdminClearLockout)
 
 	// Serve static files (like CSS, JS, and images) if needed
 	if err := r.Run(":8080"); err != nil {
@@ -82,36 +318,9 @@ func main() {
 	}
 }
 func GetCurrentUser(c *gin.Context) {
-	// Extract the JWT token from the request headers
-	// Extract the token from the URL query parameters
-	var user *models.User
-	tokenString := c.Query("token")
-	if tokenString == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization header is missing"})
-		log.Println("no user is currently logged in")
-		return
-	}
+	// The auth middleware has already loaded the user
+	user := middleware.CurrentUser(c)
 
-	// Extract the token from the "Bearer <token>" format
-	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
-
-	// Validate and parse the JWT token to get the user information
-	user, err := GetUserFromToken(tokenString) // Implement GetUserFromToken based on your needs
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		return
-	}
-
-	if err := db.Where("id = ?", user.ID).Preload("Tasks").First(&user).Error; err != nil {
-		log.Println("Error fetching user:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
-	if err := db.Where("id = ?", user.ID).First(&user).Error; err != nil {
-		log.Println("Error fetching user:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
-		return
-	}
 	// Return the user information in the response
 	c.JSON(http.StatusOK, user)
 }
@@ -143,31 +352,38 @@ func parseLoginRequest(c *gin.Context, loginRequest *LoginRequest) error {
 	return nil
 }
 
-// checkCredentials checks the user's credentials and returns the user if valid
+// checkCredentials checks the user's credentials and returns the user if valid.
+// Unknown emails and wrong passwords fail the same way and take the same time.
 func checkCredentials(email, password string) (*models.User, error) {
-	// Replace this with your database lookup logic to retrieve the user by email
-	user, err := getUserByEmail(email)
-	if err != nil {
-		return &models.User{}, err
+	user := &models.User{}
+	if err := db.Where("email = ?", email).First(user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			compareDummyPassword(password)
+			return nil, errInvalidCredentials
+		}
+		return nil, err
 	}
 	// Compare the password from the request with the hashed password from the database
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		log.Println("error : password is incorrect")
-		log.Println("error : failed to compare hash password with provided password")
-		return &models.User{}, err
+		return nil, errInvalidCredentials
 	}
+	// Rehash with the current cost while the plain password is at hand
+	upgradePasswordHash(user, password)
 	return user, nil
 }
 
-func generateJWTToken(userID uuid.UUID) (string, error) {
+func generateJWTToken(userID, sessionID uuid.UUID) (string, error) {
 	// Create a new JWT token with a custom claim (e.g., user's ID)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID.String(),                       // Convert UUID to string
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expiration time (adjust as needed)
-	})
+	claims := jwt.MapClaims{
+		"iss":     appURL,
+		"user_id": userID.String(),    // Convert UUID to string
+		"sid":     sessionID.String(), // Session the token belongs to
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(accessTokenTTL).Unix(), // Short-lived, renewed via /auth/refresh
+	}
 
-	// Sign the token with your secret key
-	tokenString, err := token.SignedString(jwtSecret)
+	// Sign the token with the active key of the keyring
+	tokenString, err := signingKeys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -175,22 +391,34 @@ func generateJWTToken(userID uuid.UUID) (string, error) {
 	return tokenString, nil
 }
 
-// GetUserFromToken extracts user information from a JWT token.
+// GetUserFromToken extracts user information from a JWT or API token.
 func GetUserFromToken(tokenString string) (*models.User, error) {
+	auth, err := authenticateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return auth.User, nil
+}
+
+// authenticateToken accepts both login session JWTs and personal API tokens.
+func authenticateToken(tokenString string) (*middleware.Auth, error) {
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		return authenticateAPIToken(tokenString)
+	}
+
 	// Parse the JWT token
 	claims, err := parseToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	// Assuming you have a User struct in your application
-	user := &models.User{
-		ID:    claims.UserID,
-		Email: claims.Email,
-		// Add other user information as needed
+	// Load the user the token was issued for
+	user := &models.User{}
+	if err := db.Where("id = ?", claims.UserID).First(user).Error; err != nil {
+		return nil, err
 	}
 
-	return user, nil
+	return newAuth(user, claims.SessionID, nil)
 }
 
 // CheckTokenValidity checks if a JWT token is valid.
@@ -201,13 +429,8 @@ func CheckTokenValidity(tokenString string) error {
 }
 
 func parseToken(tokenString string) (*CustomClaims, error) {
-	// Define the JWT secret key (you should securely store this)
-	secretKey := []byte(os.Getenv("JWT_SECRET"))
-
-	// Parse the JWT token
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+	// Parse the JWT token with the keyring used by generateJWTToken
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, signingKeys.Keyfunc)
 
 	if err != nil {
 		return nil, err
@@ -219,18 +442,23 @@ func parseToken(tokenString string) (*CustomClaims, error) {
 	}
 
 	// Extract custom claims
-	if claims, ok := token.Claims.(*CustomClaims); ok {
-		return claims, nil
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok {
+		return nil, errors.New("failed to extract claims from token")
 	}
 
-	return nil, errors.New("failed to extract claims from token")
+	// Reject tokens whose session was logged out or revoked
+	if _, err := getActiveSession(claims.SessionID); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
 func HomePage(c *gin.Context) {
-	// Check if a token is present in the request
-	tokenString := c.Query("token")
-	if tokenString == "" {
-		// Token is not present, render the "home" template
+	// Check if the browser carries a valid session
+	if !hasPageSession(c) {
+		// Not logged in, render the "home" template
 		render.RenderTemplate(c, "home", nil)
 		return
 	}
@@ -241,20 +469,18 @@ func HomePage(c *gin.Context) {
 
 func LoginPage(c *gin.Context) {
 	// Render the HTML page using the template cache
-	render.RenderTemplate(c, "login", nil)
+	render.RenderTemplate(c, "login", gin.H{"Providers": oidcProviderNames()})
 }
 
 func TodoPage(c *gin.Context) {
-	// Fetch the token from the URL query parameters
-	token := c.DefaultQuery("token", "")
-
-	if token == "" {
+	// Check the session cookies sent by the browser
+	if !hasPageSession(c) {
 		// Token is not available, redirect to /home
 		c.Redirect(http.StatusSeeOther, "/")
 		return
 	}
 
-	// Token is available, render the HTML page using the template cache
+	// Token is valid, render the HTML page using the template cache
 	render.RenderTemplate(c, "todo", nil)
 }
 
@@ -265,20 +491,12 @@ func RegisterPage(c *gin.Context) {
 
 func Register(c *gin.Context) {
 	// Get user details from HTML form
-	firstName := c.PostForm("firstname")
-	lastName := c.PostForm("lastname")
-	phone := c.PostForm("phone")
-	email := c.PostForm("email")
+	firstName := strings.TrimSpace(c.PostForm("firstname"))
+	lastName := strings.TrimSpace(c.PostForm("lastname"))
+	phone := strings.TrimSpace(c.PostForm("phone"))
+	email := strings.TrimSpace(c.PostForm("email"))
 	password := c.PostForm("password")
 
-	// Bcrypt the password received from the HTML form
-	hashedPassword, err := hashPassword(password)
-	if err != nil {
-		log.Println("Error hashing password:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
 	// Generate a UUID for the user
 	userID := uuid.New()
 
@@ -289,13 +507,35 @@ func Register(c *gin.Context) {
 		LastName:  lastName,
 		Phone:     phone,
 		Email:     email,
-		Password:  hashedPassword,
+	}
+
+	// Validate the form, collecting one message per field
+	fieldErrors := map[string]string{}
+	if firstName == "" {
+		fieldErrors["firstname"] = "Please enter your first name."
+	}
+	if lastName == "" {
+		fieldErrors["lastname"] = "Please enter your last name."
+	}
+	if _, err := netmail.ParseAddress(email); err != nil {
+		fieldErrors["email"] = "Please enter a valid email address."
+	}
+	if message, err := validatePassword(password, &user); err != nil {
+		log.Println("Error checking password policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Internal server error"})
+		return
+	} else if message != "" {
+		fieldErrors["password"] = message
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "message": "Please correct the highlighted fields.", "errors": fieldErrors})
+		return
 	}
 
 	// Check if the email already exists in the database
 	var existingUser models.User
-	if err := db.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "Email already exists. Please use a different email address."})
+	if err := db.Unscoped().Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "Email already exists. Please use a different email address.", "errors": gin.H{"email": "This email address is already registered."}})
 		return
 	} else if err != gorm.ErrRecordNotFound {
 		log.Println("Error checking existing email:", err)
@@ -303,95 +543,45 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Store the user into the database
-	if err := db.Create(&user).Error; err != nil {
-		log.Println("Error creating user:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Registration failed. Please try again later."})
-		return
-	}
-
-	// Registration successful
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Registration successful!"})
-}
-
-func hashPassword(password string) ([]byte, error) {
-	// Hash the password using bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// Bcrypt the password received from the HTML form
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		return nil, err
-	}
-	return hashedPassword, nil
-}
-
-func CreateTask(c *gin.Context) {
-	// Declare a variable to hold the task data
-	var task models.Task
-
-	// Check if the JSON data in the request body can be bound to the task struct
-	if err := c.ShouldBindJSON(&task); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Extract the token from the URL query parameters
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is missing"})
+		log.Println("Error hashing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	user.Password = hashedPassword
 
-	// Get the user from the token (You may need to implement this logic)
-	user, err := GetUserFromToken(token)
+	// Store the user into the database together with the Inbox project
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		_, err := ensureInbox(tx, user.ID)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		log.Println("Error creating user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Registration failed. Please try again later."})
 		return
 	}
-	// Assuming you have extracted the user's ID from the token correctly
-	log.Println("User from token:", user.Email)
 
-	// Set the user ID in the task
-	task.UserID = user.ID
-
-	// Generate a UUID for the task
-	task.ID = uuid.New()
-	// by default set task status to pending
-	task.Status = models.Pending
-
-	// Create the task in the database
-	if err := db.Create(&task).Error; err != nil {
-		log.Println("Error creating task:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
-		return
+	// Ask the user to confirm the email address
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Println("Error sending verification email:", err)
 	}
 
-	// Return the created task with a 201 status code
-	c.JSON(http.StatusCreated, task)
+	// Registration successful
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Registration successful! Please check your email to verify your address."})
 }
 
-func GetAllTasks(c *gin.Context) {
-	// Extract the token from the URL query parameters
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is missing"})
-		return
-	}
-
-	// Get the user ID from the token using your GetUserFromToken function
-	user, err := GetUserFromToken(token)
+func hashPassword(password string) ([]byte, error) {
+	// Hash the password using bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		return
-	}
-
-	// Retrieve tasks associated with the user
-	var tasks []models.Task
-	if err := db.Where("user_id = ?", user.ID).Find(&tasks).Error; err != nil {
-		log.Println("Error fetching tasks:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
-		return
+		return nil, err
 	}
-
-	c.JSON(http.StatusOK, gin.H{"data": tasks})
+	return hashedPassword, nil
 }
 
 func getUserByEmail(email string) (*models.User, error) {
@@ -411,174 +601,87 @@ func getUserByEmail(email string) (*models.User, error) {
 	// Return the user object and nil error if successful
 	return user, nil
 }
-func UpdateTask(c *gin.Context) {
-	// Extract the token from the URL query parameters
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token is missing"})
-		return
-	}
 
-	// Get the user ID from the token using your GetUserFromToken function
-	user, err := GetUserFromToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
-	}
-
-	// Extract the task ID from the URL route parameters
-	taskID := c.Param("id")
+func Login(c *gin.Context) {
+	var loginRequest LoginRequest
 
-	// Check if the task exists and belongs to the user
-	var task models.Task
-	if err := db.Where("id = ? AND user_id = ?", taskID, user.ID).First(&task).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+	// Parse the request data based on content type
+	if err := parseLoginRequest(c, &loginRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": err.Error()})
 		return
 	}
 
-	// Parse the request body to get the updated status and priority
-	var updateData struct {
-		Status   string `json:"status"`
-		Priority string `json:"priority"`
-	}
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+	// Refuse attempts while the account or client IP is locked out
+	rules := loginThrottleRules(loginRequest.Email, c.ClientIP())
+	wait, err := throttleWait(rules[0].key, rules[1].key)
+	if err != nil {
+		log.Println("Error checking login throttle:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
 		return
 	}
-
-	if updateData.Status != "" {
-		// Update the task status
-		task.Status = updateData.Status
-	}
-
-	if updateData.Priority != "" {
-		// Update the task priority
-		task.Priority = updateData.Priority
-	}
-
-	if err := db.Save(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+	if wait > 0 {
+		respondThrottled(c, wait)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully"})
-}
-
-// func UpdateTask(c *gin.Context) {
-// 	// Extract the token from the URL query parameters
-// 	token := c.Query("token")
-// 	if token == "" {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "token is missing"})
-// 		return
-// 	}
-
-// 	// Get the user ID from the token using your GetUserFromToken function
-// 	user, err := GetUserFromToken(token)
-// 	if err != nil {
-// 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-// 		return
-// 	}
-
-// 	// Extract the task ID from the URL route parameters
-// 	taskID := c.Param("id")
-
-// 	// Check if the task exists and belongs to the user
-// 	var task models.Task
-// 	if err := db.Where("id = ? AND user_id = ?", taskID, user.ID).First(&task).Error; err != nil {
-// 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-// 		return
-// 	}
-
-// 	// Parse the request body to get the updated status
-// 	var updateData struct {
-// 		Status   string `json:"status"`
-// 		Priority string `json:"priority"`
-// 	}
-// 	if err := c.ShouldBindJSON(&updateData); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
-// 		return
-// 	}
-// 	if updateData.Status == "" {
-// 		// Update the task pre
-// 		task.Priority = updateData.Priority
-// 		if err := db.Save(&task).Error; err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task priority"})
-// 			return
-// 		}
-// 		c.JSON(http.StatusOK, gin.H{"message": "task priority updated successfully"})
-// 	} else {
-// 		// Update the task status
-// 		task.Status = updateData.Status
-// 		if err := db.Save(&task).Error; err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task status"})
-// 			return
-// 		}
-// 		c.JSON(http.StatusOK, gin.H{"message": "task status updated successfully"})
-
-// 	}
-
-// }
-
-func DeleteTask(c *gin.Context) {
-	// Extract the token from the URL query parameters
-	token := c.Query("token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token is missing"})
+	// Check the credentials and get the user
+	user, err := checkCredentials(loginRequest.Email, loginRequest.Password)
+	if err == errInvalidCredentials {
+		recordFailure(rules, loginRequest.Email, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": "Invalid email or password."})
 		return
-	}
-
-	// Get the user ID from the token using your GetUserFromToken function
-	user, err := GetUserFromToken(token)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	} else if err != nil {
+		log.Println("Error checking credentials:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
 		return
 	}
 
-	// Extract the task ID from the URL route parameters
-	taskID := c.Param("id")
-
-	// Check if the task exists and belongs to the user
-	var task models.Task
-	if err := db.Where("id = ? AND user_id = ?", taskID, user.ID).First(&task).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
-		return
+	// The password was right, forget earlier failures of this account
+	if err := clearThrottle(db, rules[0].key); err != nil {
+		log.Println("Error clearing login throttle:", err)
 	}
 
-	// Delete the task
-	if err := db.Delete(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete task"})
+	// Disabled accounts cannot log in
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "error": "Your account has been disabled."})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "task deleted successfully"})
-}
-
-func Login(c *gin.Context) {
-	var loginRequest LoginRequest
-
-	// Parse the request data based on content type
-	if err := parseLoginRequest(c, &loginRequest); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": err.Error()})
+	// Apply the policy for unverified email addresses
+	if user.EmailVerifiedAt == nil && unverifiedLoginPolicy == UnverifiedBlock {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "error": "Please verify your email address before logging in.", "email_verified": false})
 		return
 	}
 
-	// Check the credentials and get the user
-	user, err := checkCredentials(loginRequest.Email, loginRequest.Password)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": err.Error()})
+	// Users with two-factor authentication must finish the login at /login/mfa
+	if user.MFAEnabledAt != nil {
+		challenge, err := generateMFAChallenge(user.ID)
+		if err != nil {
+			log.Println("Error generating MFA challenge:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to generate JWT token."})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge})
 		return
 	}
 
-	// Generate a JWT token
-	token, err := generateJWTToken(user.ID)
+	// Start a new session with an access and refresh token
+	pair, err := createSession(c, user.ID)
 	if err != nil {
+		log.Println("Error creating session:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to generate JWT token."})
 		return
 	}
 
 	log.Println("success: JWT token generated")
-	log.Println("token: ", token)
 
-	// Respond with the generated token
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if user.EmailVerifiedAt == nil && unverifiedLoginPolicy == UnverifiedWarn {
+		pair.Warning = "Your email address is not verified yet."
+	}
+
+	// Browsers use the cookies, API clients the response body
+	setSessionCookies(c, pair)
+
+	// Respond with the generated tokens
+	c.JSON(http.StatusOK, pair)
 }
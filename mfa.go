@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"task-manager-app/totp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// mfaChallengePurpose marks tokens that only allow finishing a login at /login/mfa.
+	mfaChallengePurpose = "mfa_challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+	recoveryCodeCount   = 10
+)
+
+var errInvalidMFACode = errors.New("invalid authentication code")
+
+// MFAChallengeClaims are the claims of the intermediate token returned by
+// Login for users with two-factor authentication enabled.
+type MFAChallengeClaims struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Purpose string    `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// MFACodeRequest carries a TOTP or recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code" form:"code" binding:"required"`
+}
+
+// MFALoginRequest is the body of POST /login/mfa.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" form:"mfa_token" binding:"required"`
+	Code     string `json:"code" form:"code" binding:"required"`
+}
+
+// generateMFAChallenge signs a short-lived token proving the password step succeeded.
+func generateMFAChallenge(userID uuid.UUID) (string, error) {
+	return signingKeys.Sign(MFAChallengeClaims{
+		UserID:  userID,
+		Purpose: mfaChallengePurpose,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(mfaChallengeTTL).Unix(),
+		},
+	})
+}
+
+// parseMFAChallenge validates a challenge token and returns its claims.
+func parseMFAChallenge(tokenString string) (*MFAChallengeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MFAChallengeClaims{}, signingKeys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*MFAChallengeClaims)
+	if !ok || !token.Valid || claims.Purpose != mfaChallengePurpose {
+		return nil, errors.New("invalid mfa token")
+	}
+	return claims, nil
+}
+
+// normalizeRecoveryCode makes recovery codes case and dash insensitive.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the new
+// codes in plain text. They are only ever shown once.
+func generateRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)
+		codes = append(codes, code[:4]+"-"+code[4:])
+
+		if err := tx.Create(&models.RecoveryCode{
+			ID:       uuid.New(),
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, for the
+// user locked inside tx. Accepted codes are consumed so they cannot be replayed.
+func verifySecondFactor(tx *gorm.DB, user *models.User, code string) error {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		return tx.Model(user).Update("totp_last_step", step).Error
+	}
+
+	var recovery models.RecoveryCode
+	err := tx.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		First(&recovery).Error
+	if err == gorm.ErrRecordNotFound {
+		return errInvalidMFACode
+	} else if err != nil {
+		return err
+	}
+
+	log.Println("recovery code used for user:", user.ID)
+	return tx.Model(&recovery).Update("used_at", time.Now()).Error
+}
+
+// lockUser loads the user with a row lock for the rest of the transaction.
+func lockUser(tx *gorm.DB, userID uuid.UUID) (*models.User, error) {
+	user := &models.User{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func EnrollMFA(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user.MFAEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Println("Error generating TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	// The secret stays pending until it is confirmed with a valid code
+	if err := db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		log.Println("Error saving TOTP secret:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(mfaIssuer, user.Email, secret),
+	})
+}
+
+func ConfirmMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is missing"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, middleware.CurrentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		if user.MFAEnabledAt != nil || user.TOTPSecret == "" {
+			return errInvalidMFACode
+		}
+
+		step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return errInvalidMFACode
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{"totp_last_step": step, "mfa_enabled_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code or no pending enrollment"})
+		return
+	} else if err != nil {
+		log.Println("Error confirming MFA:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+func DisableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is missing"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, middleware.CurrentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		if user.MFAEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		if err := verifySecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+		return resetMFA(tx, user.ID)
+	})
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	} else if err != nil {
+		log.Println("Error disabling MFA:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// resetMFA removes the TOTP secret and recovery codes of a user.
+func resetMFA(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"totp_secret": "", "totp_last_step": 0, "mfa_enabled_at": nil}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is missing"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, middleware.CurrentUser(c).ID)
+		if err != nil {
+			return err
+		}
+		if user.MFAEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		if err := verifySecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err == errInvalidMFACode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	} else if err != nil {
+		log.Println("Error regenerating recovery codes:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to regenerate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	claims, err := parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": "Login expired, please log in again."})
+		return
+	}
+
+	// Guessing codes is throttled like guessing passwords
+	rules := []throttleRule{{key: mfaThrottleKey(claims.UserID), lockoutAfter: loginLockoutThreshold}}
+	wait, err := throttleWait(rules[0].key)
+	if err != nil {
+		log.Println("Error checking MFA throttle:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+	if wait > 0 {
+		respondThrottled(c, wait)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, claims.UserID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt != nil {
+			return errAccountDisabled
+		}
+		if user.MFAEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		return verifySecondFactor(tx, user, req.Code)
+	})
+	if err == errInvalidMFACode {
+		recordFailure(rules, "", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": "Invalid authentication code."})
+		return
+	} else if err == errAccountDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "error": "Your account has been disabled."})
+		return
+	} else if err != nil {
+		log.Println("Error verifying MFA code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+
+	if err := clearThrottle(db, rules[0].key); err != nil {
+		log.Println("Error clearing MFA throttle:", err)
+	}
+
+	// Second factor accepted, start the real session
+	pair, err := createSession(c, claims.UserID)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to generate JWT token."})
+		return
+	}
+
+	setSessionCookies(c, pair)
+	c.JSON(http.StatusOK, pair)
+}
@@ -3,45 +3,143 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"task-manager-app/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
-var jwtSecret []byte
+const (
+	// AccessTokenCookie is the HttpOnly cookie that carries the access token for browser sessions.
+	AccessTokenCookie = "access_token"
+	// authKey is the gin context key holding the authentication result.
+	authKey = "auth"
+)
+
+// Auth describes the authenticated caller of a request.
+type Auth struct {
+	User *models.User
+	// SessionID is set for login sessions and zero for API tokens.
+	SessionID uuid.UUID
+	// Scopes limits what an API token may do. Nil means full access.
+	Scopes []string
+	// Permissions are granted by the user's role.
+	Permissions []string
+}
+
+// HasScope reports whether the caller is allowed to use the given scope.
+func (a *Auth) HasScope(scope string) bool {
+	if a.Scopes == nil {
+		return true
+	}
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the user's role grants the permission.
+func (a *Auth) HasPermission(permission string) bool {
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator validates an access or API token and describes its owner.
+type Authenticator func(tokenString string) (*Auth, error)
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware rejects requests without a valid token and stores the
+// authenticated caller in the context for the handlers that follow.
+func AuthMiddleware(authenticate Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get the JWT token from the "Authorization" header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		tokenString, ok := TokenFromRequest(c)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "JWT token is missing"})
 			c.Abort()
 			return
 		}
 
-		// Check if the token starts with "Bearer "
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+		auth, err := authenticate(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid JWT token"})
 			c.Abort()
 			return
 		}
 
-		// Extract the token without the "Bearer " prefix
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		c.Set(authKey, auth)
 
-		// Parse the JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil // Use the same JWT secret key defined earlier
-		})
+		// If the token is valid, proceed to the next handler
+		c.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid JWT token"})
+// RequireScope only lets callers through whose token grants the scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CurrentAuth(c).HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "token is missing scope " + scope})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		// If the token is valid, proceed to the next handler
+// RequirePermission only lets callers through whose role grants the permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CurrentAuth(c).HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects API tokens, for endpoints that manage the account
+// itself and must only be used from a real login.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentAuth(c).SessionID == uuid.Nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint requires a login session"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
+
+// TokenFromRequest returns the access token from the "Authorization: Bearer"
+// header, falling back to the access token cookie.
+func TokenFromRequest(c *gin.Context) (string, bool) {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return "", false
+		}
+		return strings.TrimPrefix(authHeader, "Bearer "), true
+	}
+
+	if cookie, err := c.Cookie(AccessTokenCookie); err == nil && cookie != "" {
+		return cookie, true
+	}
+
+	return "", false
+}
+
+// CurrentAuth returns the authentication stored by AuthMiddleware. It must
+// only be called from handlers behind the middleware.
+func CurrentAuth(c *gin.Context) *Auth {
+	return c.MustGet(authKey).(*Auth)
+}
+
+// CurrentUser returns the user stored by AuthMiddleware. It must only be
+// called from handlers behind the middleware.
+func CurrentUser(c *gin.Context) *models.User {
+	return CurrentAuth(c).User
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes that can be granted to API tokens.
+const (
+	ScopeTasksRead   string = "tasks:read"
+	ScopeTasksWrite  string = "tasks:write"
+	ScopeProfileRead string = "profile:read"
+)
+
+// APIScopes lists every scope an API token may be granted.
+var APIScopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeProfileRead}
+
+// APIToken is a personal access token used by scripts and integrations. Only
+// the SHA-256 hash of the token is stored; Prefix helps users recognise it.
+type APIToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index" json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the scopes granted to the token.
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// Expired reports whether the token has passed its expiry time.
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChecklistItem is a lightweight step inside a task that only has a text and
+// a done flag, unlike a full subtask.
+type ChecklistItem struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	TaskID    uuid.UUID `gorm:"type:uuid;index" json:"task_id"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
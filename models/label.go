@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Label is a user-owned tag such as "@home" that can be put on any number of tasks.
+type Label struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the label is in the trash. Its tasks keep it
+	// and get it back when it is restored.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// TaskLabel is a row of the join table between tasks and labels.
+type TaskLabel struct {
+	TaskID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	LabelID uuid.UUID `gorm:"type:uuid;primaryKey"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginThrottle counts recent failed logins for one key, such as an account
+// or a client IP address.
+type LoginThrottle struct {
+	Key         string     `gorm:"primaryKey" json:"key"`
+	Failures    int        `json:"failures"`
+	LockedUntil *time.Time `json:"locked_until"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Lockout is the audit record written whenever a key gets locked out.
+type Lockout struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	Key         string     `gorm:"index" json:"key"`
+	Email       string     `json:"email"`
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	ClearedAt   *time.Time `json:"cleared_at"`
+	ClearedBy   *uuid.UUID `gorm:"type:uuid" json:"cleared_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// InboxName is the name of the project every user starts with.
+const InboxName string = "Inbox"
+
+// Project groups the tasks of one user. Every user has exactly one Inbox
+// project, which new tasks go to by default and which cannot be deleted.
+type Project struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Icon      string    `json:"icon"`
+	Inbox     bool      `json:"inbox"`
+	Archived  bool      `json:"archived"`
+	SortOrder int       `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set while the project is in the trash, with the tasks it held.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the user has
+// lost access to the authenticator app. Only the SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	CodeHash  string     `gorm:"index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
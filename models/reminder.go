@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Channels reminders can be delivered through.
+const (
+	ChannelEmail   string = "email"
+	ChannelWebhook string = "webhook"
+	ChannelInApp   string = "in_app"
+)
+
+// Reminder is a pending or delivered notification about a task. It is
+// either set for an absolute time or for OffsetMinutes before the due date,
+// in which case RemindAt follows the due date.
+type Reminder struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	TaskID        uuid.UUID `gorm:"type:uuid;index" json:"task_id"`
+	UserID        uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Channel       string    `json:"channel"`
+	OffsetMinutes *int      `json:"offset_minutes"`
+	// RemindAt is empty for relative reminders of tasks without a due date.
+	RemindAt *time.Time `json:"remind_at"`
+	SentAt   *time.Time `json:"sent_at"`
+	// Failed deliveries are retried at NextAttemptAt, up to a few attempts.
+	NextAttemptAt *time.Time `json:"-"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Notification is a message shown inside the app, such as a delivered reminder.
+type Notification struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	TaskID    *uuid.UUID `gorm:"type:uuid" json:"task_id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Built-in roles. Custom roles are stored in the roles table.
+const (
+	RoleUser  string = "user"
+	RoleAdmin string = "admin"
+)
+
+// Permissions that can be granted to roles.
+const (
+	PermUsersRead   string = "users:read"
+	PermUsersManage string = "users:manage"
+	PermRolesManage string = "roles:manage"
+)
+
+// Permissions lists every permission a role may be granted.
+var Permissions = []string{PermUsersRead, PermUsersManage, PermRolesManage}
+
+// BuiltInRoles maps the built-in role names to their fixed permissions.
+var BuiltInRoles = map[string][]string{
+	RoleUser:  {},
+	RoleAdmin: Permissions,
+}
+
+// Role is a custom role with a set of permissions.
+type Role struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	Name        string    `gorm:"uniqueIndex" json:"name"`
+	Permissions string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PermissionList returns the permissions granted by the role.
+func (r *Role) PermissionList() []string {
+	return strings.Fields(r.Permissions)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a single login of a user. Access tokens carry the session ID so
+// that revoking the session invalidates every token issued for it.
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Active reports whether the session can still be used at the given time.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is one link of a session's rotation chain. Only the SHA-256
+// hash of the token is stored; a token that has already been used is never
+// accepted again.
+type RefreshToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	SessionID uuid.UUID  `gorm:"type:uuid;index" json:"session_id"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
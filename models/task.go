@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 const (
@@ -18,13 +19,50 @@ const (
 	High   string = "high"
 )
 
+// What the next occurrence of a recurring task is scheduled from.
+const (
+	RepeatFromDue        string = "due"
+	RepeatFromCompletion string = "completion"
+)
+
 type Task struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
-	Title     string    `json:"title"`
-	Status    string    `json:"status"`
-	Priority  string    `json:"priority"`
-	UserID    uuid.UUID `json:"user_id" gorm:"foreignkey:UserID;references:ID"` // Foreign key to User table
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	DeletedAt time.Time `json:"deleted_at"`
+	ID    uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	Title string    `json:"title"`
+	// Description is Markdown, rendered by the client.
+	Description string `gorm:"type:text" json:"description"`
+	Status      string `gorm:"index:idx_tasks_user_status,priority:2" json:"status"`
+	Priority    string `json:"priority"`
+	// CompletedAt and CanceledAt are set while the task is in that status.
+	CompletedAt *time.Time `json:"completed_at"`
+	CanceledAt  *time.Time `json:"canceled_at"`
+	// StartAt and DueAt are instants. For all-day tasks they hold midnight of
+	// the day in the task's time zone.
+	StartAt  *time.Time `json:"start_at"`
+	DueAt    *time.Time `gorm:"index:idx_tasks_user_due,priority:2" json:"due_at"`
+	AllDay   bool       `json:"all_day"`
+	TimeZone string     `json:"timezone"`
+	// ProjectID is the project the task belongs to, the user's Inbox by default.
+	ProjectID *uuid.UUID `gorm:"type:uuid;index" json:"project_id"`
+	Labels    []Label    `gorm:"many2many:task_labels;" json:"labels"`
+	// ParentID makes the task a subtask of another task.
+	ParentID *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	// AutoComplete completes the task once all subtasks and checklist items are done.
+	AutoComplete bool            `json:"auto_complete"`
+	Checklist    []ChecklistItem `gorm:"foreignKey:TaskID" json:"checklist"`
+	// Progress is the percentage of done subtasks and checklist items, it is not stored.
+	Progress int `gorm:"-" json:"progress"`
+	// Recurrence is an RFC 5545 RRULE evaluated in the task's time zone.
+	// Completing the task creates the next occurrence.
+	Recurrence string `json:"recurrence"`
+	RepeatFrom string `json:"repeat_from"`
+	// SeriesID is shared by all occurrences of a recurring task, Occurrence
+	// numbers them from 1.
+	SeriesID   *uuid.UUID `gorm:"type:uuid;index" json:"series_id"`
+	Occurrence int        `json:"occurrence"`
+	// Composite indexes start with the user, every task query is scoped to one
+	UserID    uuid.UUID `json:"user_id" gorm:"foreignkey:UserID;references:ID;index:idx_tasks_user_created,priority:1;index:idx_tasks_user_updated,priority:1;index:idx_tasks_user_due,priority:1;index:idx_tasks_user_status,priority:1"` // Foreign key to User table
+	CreatedAt time.Time `gorm:"index:idx_tasks_user_created,priority:2" json:"created_at"`
+	UpdatedAt time.Time `gorm:"index:idx_tasks_user_updated,priority:2" json:"updated_at"`
+	// DeletedAt is set while the task is in the trash.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -12,9 +13,21 @@ type User struct {
 	LastName  string    `json:"lastname"`
 	Phone     string    `json:"phone"`
 	Email     string    `json:"email"`
-	Password  []byte    `json:"-"`
-	Tasks     []Task    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	DeletedAt time.Time `json:"deleted_at"`
+	// TimeZone is an IANA name such as "Europe/Berlin", empty means UTC.
+	TimeZone string `json:"timezone"`
+	// WebhookURL receives reminders sent through the webhook channel.
+	WebhookURL      string     `json:"webhook_url"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Password        []byte     `json:"-"`
+	TOTPSecret      string     `json:"-"`
+	TOTPLastStep    int64      `json:"-"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at"`
+	Role            string     `gorm:"default:user" json:"role"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	Tasks               []Task     `json:"-"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	// DeletedAt is set when the user or an admin deleted the account, it can
+	// be restored until purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
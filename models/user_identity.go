@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Provider  string    `gorm:"uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purposes of single-use user tokens.
+const (
+	PurposePasswordReset     string = "password_reset"
+	PurposeEmailVerification string = "email_verification"
+	PurposeEmailChange       string = "email_change"
+	PurposeMagicLogin        string = "magic_login"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email. Only the
+// SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Purpose   string    `gorm:"index" json:"purpose"`
+	TokenHash string    `gorm:"uniqueIndex" json:"-"`
+	// Data holds purpose specific details, such as the new address of an email change.
+	Data      string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the token can still be redeemed at the given time.
+func (t *UserToken) Usable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
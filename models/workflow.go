@@ -0,0 +1,11 @@
+package models
+
+import "github.com/google/uuid"
+
+// WorkflowTransition allows the tasks of a user to move from one status to
+// another. Users without transitions use the default workflow.
+type WorkflowTransition struct {
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	FromStatus string    `gorm:"primaryKey" json:"from"`
+	ToStatus   string    `gorm:"primaryKey" json:"to"`
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"task-manager-app/mailer"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification is a message about a task addressed to one user.
+type Notification struct {
+	User    *models.User
+	Task    *models.Task
+	Title   string
+	Body    string
+	SentAt  time.Time
+	TaskURL string
+}
+
+// Notifier delivers notifications through one channel. The delivery is
+// recorded in tx, notifiers that store the notification write through it so
+// it is rolled back with the rest of the delivery.
+type Notifier interface {
+	Notify(tx *gorm.DB, n Notification) error
+}
+
+// EmailNotifier sends notifications as plain text emails.
+type EmailNotifier struct {
+	Mailer mailer.Mailer
+}
+
+func (e *EmailNotifier) Notify(tx *gorm.DB, n Notification) error {
+	body := n.Body
+	if n.TaskURL != "" {
+		body += "\n\n" + n.TaskURL
+	}
+	return e.Mailer.Send(mailer.Message{To: n.User.Email, Subject: n.Title, Body: body + "\n"})
+}
+
+// webhookPayload is the JSON posted by WebhookNotifier.
+type webhookPayload struct {
+	Event  string       `json:"event"`
+	Title  string       `json:"title"`
+	Body   string       `json:"body"`
+	Task   *models.Task `json:"task"`
+	SentAt time.Time    `json:"sent_at"`
+}
+
+// PublicIP reports whether ip is a public unicast address. Loopback, private,
+// link-local, multicast and unspecified addresses are not.
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// publicOnly is a net.Dialer Control function refusing connections to
+// addresses that are not public. It runs after the host name is resolved, so
+// names pointing at internal services are refused as well.
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicIP(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// NewWebhookClient returns an HTTP client for webhooks that only connects to
+// public addresses, including when following redirects.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy, it would be the only address checked
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+// WebhookNotifier posts notifications as JSON to the user's webhook URL.
+// When Secret is set the body is signed with HMAC-SHA256 in the
+// X-Signature-256 header, formatted as "sha256=<hex>".
+type WebhookNotifier struct {
+	Client *http.Client
+	Secret string
+}
+
+func (w *WebhookNotifier) Notify(tx *gorm.DB, n Notification) error {
+	if n.User.WebhookURL == "" {
+		return fmt.Errorf("no webhook url configured")
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event:  "task.reminder",
+		Title:  n.Title,
+		Body:   n.Body,
+		Task:   n.Task,
+		SentAt: n.SentAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.User.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// InAppNotifier stores notifications for the user to read in the app.
+type InAppNotifier struct{}
+
+func (a *InAppNotifier) Notify(tx *gorm.DB, n Notification) error {
+	notification := models.Notification{
+		ID:     uuid.New(),
+		UserID: n.User.ID,
+		Title:  n.Title,
+		Body:   n.Body,
+	}
+	if n.Task != nil {
+		notification.TaskID = &n.Task.ID
+	}
+	return tx.Create(&notification).Error
+}
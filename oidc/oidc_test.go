@@ -0,0 +1,211 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"strings"
+	"task-manager-app/oidc"
+	"task-manager-app/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	clientID    = "task-manager"
+	redirectURL = "http://app.test/auth/oidc/callback"
+)
+
+// newProvider starts a mock identity provider and a provider configured for it.
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	idp := oidctest.NewServer(clientID)
+	t.Cleanup(idp.Close)
+	provider := oidc.NewProvider(oidc.Config{
+		Name:        "mock",
+		Issuer:      idp.Issuer(),
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+		Scopes:      []string{"openid", "email"},
+	}, idp.Client())
+	return idp, provider
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp, provider := newProvider(t)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.URL+"/authorize?") {
+		t.Errorf("authorization URL %s is not the discovered endpoint", authURL)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"redirect_uri":          redirectURL,
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oidc.CodeChallenge("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer(clientID)
+	defer idp.Close()
+	provider := oidc.NewProvider(oidc.Config{Name: "mock", Issuer: idp.Issuer() + "/other", ClientID: clientID}, idp.Client())
+
+	if _, err := provider.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("discovery accepted a document for another issuer")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp, provider := newProvider(t)
+	idp.Login(jwt.MapClaims{"sub": "user-1", "email": "jane@example.com", "email_verified": true})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		verifier string
+		reuse    bool
+		wantErr  bool
+	}{
+		{"matching verifier", "verifier-1", false, false},
+		{"wrong verifier", "verifier-2", false, true},
+		{"code used twice", "verifier-1", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state, err := idp.Authorize(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != "state-1" {
+				t.Errorf("state = %q, want state-1", state)
+			}
+			if tt.reuse {
+				if _, err := provider.Exchange(ctx, code, tt.verifier); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rawIDToken, err := provider.Exchange(ctx, code, tt.verifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Exchange succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp, provider := newProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims { return idp.Claims("user-1", "nonce-1") }
+	with := func(name string, value interface{}) string {
+		claims := valid()
+		claims[name] = value
+		return idp.Sign(claims)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", idp.Sign(valid()), ""},
+		{"audience list", with("aud", []string{"other", clientID}), ""},
+		{"bad signature", oidctest.Sign(otherKey, oidctest.KeyID, valid()), "verification error"},
+		{"unknown key", oidctest.Sign(otherKey, "other-key", valid()), "unknown key id"},
+		{"symmetric algorithm", hs256(valid()), "unexpected signing method"},
+		{"wrong audience", with("aud", "other"), "audience mismatch"},
+		{"wrong issuer", with("iss", "https://evil.example.com"), "issuer mismatch"},
+		{"expired", with("exp", time.Now().Add(-2*time.Minute).Unix()), "expired"},
+		{"expired within clock skew", with("exp", time.Now().Add(-30*time.Second).Unix()), ""},
+		{"issued in the future", with("iat", time.Now().Add(5*time.Minute).Unix()), "before issued"},
+		{"nonce mismatch", with("nonce", "nonce-2"), "nonce mismatch"},
+		{"no subject", with("sub", ""), "no subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tt.token, "nonce-1")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("VerifyIDToken: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("VerifyIDToken error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigsFromEnv(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "google, corp")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com/")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OIDC_CORP_ISSUER", "https://sso.corp.example")
+	t.Setenv("OIDC_CORP_SCOPES", "openid email")
+	t.Setenv("OIDC_CORP_LINK_BY_EMAIL", "true")
+
+	configs := oidc.ConfigsFromEnv(redirectURL)
+	if len(configs) != 2 {
+		t.Fatalf("got %d configs, want 2", len(configs))
+	}
+	google, corp := configs[0], configs[1]
+	if google.Name != "google" || google.Issuer != "https://accounts.google.com" || google.ClientID != "google-client" ||
+		len(google.Scopes) != 3 || google.LinkByEmail || google.RedirectURL != redirectURL {
+		t.Errorf("google config = %+v", google)
+	}
+	if corp.Name != "corp" || strings.Join(corp.Scopes, " ") != "openid email" || !corp.LinkByEmail {
+		t.Errorf("corp config = %+v", corp)
+	}
+}
+
+// hs256 signs claims with a shared secret, which ID tokens must not use.
+func hs256(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = oidctest.KeyID
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
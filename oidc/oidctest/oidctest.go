@@ -0,0 +1,225 @@
+// Package oidctest provides a minimal OpenID Connect identity provider for
+// tests. It serves discovery, an authorization endpoint that approves every
+// request, a token endpoint enforcing PKCE (S256) and a JWKS with one RSA key.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"task-manager-app/oidc"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// KeyID is the kid of the key ID tokens are signed with.
+const KeyID = "test-key"
+
+// Server is a running mock identity provider.
+type Server struct {
+	*httptest.Server
+	ClientID string
+	Key      *rsa.PrivateKey
+
+	mu sync.Mutex
+	// user holds the claims of the user that logs in at /authorize
+	user  jwt.MapClaims
+	codes map[string]grant
+}
+
+// grant is an issued authorization code and what it is bound to.
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      jwt.MapClaims
+}
+
+// NewServer starts a provider for the client ID. Call Close when done.
+func NewServer(clientID string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	s := &Server{ClientID: clientID, Key: key, codes: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Issuer is the issuer URL to configure the provider with.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// Login sets the user that the next authorization requests log in as. The
+// claims are added to the ID token, "sub" is required.
+func (s *Server) Login(claims jwt.MapClaims) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = claims
+}
+
+// Claims returns valid ID token claims for the subject, for use with Sign.
+func (s *Server) Claims(subject, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   s.Issuer(),
+		"sub":   subject,
+		"aud":   s.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+}
+
+// Sign signs claims as an ID token with the provider's key.
+func (s *Server) Sign(claims jwt.MapClaims) string {
+	return Sign(s.Key, KeyID, claims)
+}
+
+// Sign signs claims as an RS256 token with the key and kid.
+func Sign(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	return signed
+}
+
+// Authorize opens an authorization URL as the browser would and returns the
+// code and state the provider redirects back with.
+func (s *Server) Authorize(authURL string) (code, state string, err error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorize: unexpected status %s", resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+	return location.Query().Get("code"), location.Query().Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.Issuer(),
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+// authorize approves the request as the logged in user and redirects back
+// with a code.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != s.ClientID ||
+		q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	if s.user == nil {
+		s.mu.Unlock()
+		http.Error(w, "login_required", http.StatusBadRequest)
+		return
+	}
+	s.codes[code] = grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		claims:      s.user,
+	}
+	s.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client, redirect URI and PKCE
+// verifier it was issued for.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	if !ok || g.clientID != r.PostForm.Get("client_id") || g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := s.Claims("", g.nonce)
+	for name, value := range g.claims {
+		claims[name] = value
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     s.Sign(claims),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": KeyID,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
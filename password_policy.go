@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"task-manager-app/models"
+	"task-manager-app/passwordpolicy"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errPasswordPolicy = errors.New("password does not meet the policy")
+
+var (
+	passwordPolicy *passwordpolicy.Policy
+	// bcryptCost is used for new hashes, older hashes are upgraded on login.
+	bcryptCost int
+)
+
+// setupPasswordPolicy configures the password policy and bcrypt cost from the environment.
+func setupPasswordPolicy() {
+	passwordPolicy = &passwordpolicy.Policy{
+		MinLength: intFromEnv("PASSWORD_MIN_LENGTH", 8),
+		MinScore:  intFromEnv("PASSWORD_MIN_SCORE", 2),
+	}
+
+	// Range files of breached password hashes, see passwordpolicy.BreachedList
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		list, err := passwordpolicy.NewBreachedList(dir)
+		if err != nil {
+			log.Println("Error loading breached password list:", err)
+		} else {
+			list.MinCount = intFromEnv("BREACHED_PASSWORDS_MIN_COUNT", 1)
+			passwordPolicy.Breached = list
+		}
+	}
+
+	bcryptCost = intFromEnv("BCRYPT_COST", bcrypt.DefaultCost)
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		log.Println("invalid BCRYPT_COST, using the default")
+		bcryptCost = bcrypt.DefaultCost
+	}
+}
+
+// validatePassword checks a new password for the user against the policy.
+// It returns the message to show when the password is rejected.
+func validatePassword(password string, user *models.User) (string, error) {
+	err := passwordPolicy.Check(password, user.Email, user.FirstName, user.LastName)
+	var violation *passwordpolicy.Violation
+	if errors.As(err, &violation) {
+		return violation.Message, nil
+	}
+	return "", err
+}
+
+// upgradePasswordHash rehashes the password with the configured cost when the
+// stored hash is weaker. It must only be called with the verified password.
+func upgradePasswordHash(user *models.User, password string) {
+	cost, err := bcrypt.Cost(user.Password)
+	if err != nil || cost >= bcryptCost {
+		return
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		log.Println("Error hashing password:", err)
+		return
+	}
+	if err := db.Model(user).Update("password", hashedPassword).Error; err != nil {
+		log.Println("Error upgrading password hash:", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"task-manager-app/mailer"
+	"task-manager-app/models"
+	"task-manager-app/render"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ForgotPasswordRequest is the body of POST /password/forgot.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" form:"email" binding:"required"`
+}
+
+// ResetPasswordRequest is the body of POST /password/reset.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" form:"token" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+func ForgotPasswordPage(c *gin.Context) {
+	render.RenderTemplate(c, "forgot_password", nil)
+}
+
+func ResetPasswordPage(c *gin.Context) {
+	// The token from the emailed link is posted back with the new password
+	render.RenderTemplate(c, "reset_password", gin.H{"Token": c.Query("token")})
+}
+
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	// Always answer the same way so the endpoint cannot be used to find out
+	// which email addresses are registered
+	response := gin.H{"message": "If an account exists for this email, a reset link has been sent."}
+
+	user, err := getUserByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	limited, err := tokenEmailRateLimited(user, models.PurposePasswordReset)
+	if err != nil {
+		log.Println("Error checking password reset rate limit:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+	// A different answer would tell that the account exists
+	if limited {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := issueUserToken(user.ID, models.PurposePasswordReset, "", passwordResetTTL)
+	if err != nil {
+		log.Println("Error creating password reset token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+
+	link := appURL + "/password/reset?token=" + url.QueryEscape(token)
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Use the link below to choose a new password. It expires in " + passwordResetTTL.String() + ".\n\n" +
+			link + "\n\n" +
+			"If you did not ask for a password reset you can ignore this email.\n",
+	}
+	if err := mail.Send(msg); err != nil {
+		log.Println("Error sending password reset email:", err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "Invalid request"})
+		return
+	}
+
+	// Rejected passwords roll the transaction back so the link can be used again
+	var policyMessage string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, req.Token, models.PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Where("id = ?", record.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		policyMessage, err = validatePassword(req.Password, &user)
+		if err != nil {
+			return err
+		}
+		if policyMessage != "" {
+			return errPasswordPolicy
+		}
+
+		hashedPassword, err := hashPassword(req.Password)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+
+		// Whoever knew the old password must not stay logged in
+		return revokeUserSessions(tx, record.UserID)
+	})
+	if err == errInvalidUserToken {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "The reset link is invalid or has expired."})
+		return
+	} else if err == errPasswordPolicy {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": "failed", "error": policyMessage, "errors": gin.H{"password": policyMessage}})
+		return
+	} else if err != nil {
+		log.Println("Error resetting password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Your password has been reset. Please log in."})
+}
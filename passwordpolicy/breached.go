@@ -0,0 +1,66 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of the SHA-1 hash used to
+// pick a range file, as in the k-anonymity model of Have I Been Pwned.
+const prefixLength = 5
+
+// BreachedList looks passwords up in a local copy of a breached password
+// corpus in hash-prefix form: one file per 5 character SHA-1 prefix, named
+// "<PREFIX>.txt" and holding "SUFFIX:COUNT" lines. This is the layout
+// produced by the official range downloader, so the plain passwords never
+// leave the server and only the relevant range is read for each check.
+type BreachedList struct {
+	Dir string
+	// MinCount ignores passwords seen fewer times than this in breaches.
+	MinCount int
+}
+
+// NewBreachedList returns a list reading range files from dir.
+func NewBreachedList(dir string) (*BreachedList, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &BreachedList{Dir: dir, MinCount: 1}, nil
+}
+
+// Contains reports whether the password appears in the breached password list.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(l.Dir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		// No breached password shares this prefix
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		entry, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		// A missing count means the password was seen at least once
+		seen, err := strconv.Atoi(count)
+		if err != nil {
+			seen = 1
+		}
+		return seen >= l.MinCount, nil
+	}
+	return false, scanner.Err()
+}
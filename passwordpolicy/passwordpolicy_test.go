@@ -0,0 +1,141 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var userInputs = []string{"jane.doe@example.com", "Jane", "Doe"}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"", 0},
+		{"aaaaaaaaaaaa", 0},
+		{"password", 0},
+		{"Password1!", 0},
+		{"qwertyuiop", 0},
+		{"abcdefgh12345", 0},
+		{"janedoe2024!", 1},
+		{"Tr0ub4dor&3", 3},
+		{"kX9#mQ2$vL7!pR4", 4},
+		{"correct horse battery staple", 4},
+	}
+	for _, tt := range tests {
+		if got := Score(tt.password, userInputs...); got != tt.want {
+			t.Errorf("Score(%q) = %d, want %d", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestScoreUserInputs(t *testing.T) {
+	without := Score("janedoe2024!")
+	with := Score("janedoe2024!", userInputs...)
+	if with >= without {
+		t.Errorf("Score with user inputs = %d, want less than %d without", with, without)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	writeRange(t, dir, "5BAA6", "1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n")
+	policy := &Policy{MinLength: 8, MinScore: 3, Breached: &BreachedList{Dir: dir, MinCount: 1}}
+
+	tests := []struct {
+		name      string
+		password  string
+		violation bool
+	}{
+		{"strong", "kX9#mQ2$vL7!pR4", false},
+		{"too short", "kX9#mQ2", true},
+		{"contains the name", "Jane-kX9#mQ2$vL7!", true},
+		{"contains the email", "xx-doe-kX9#mQ2$vL7", true},
+		{"too weak", "abcdefgh12345", true},
+		{"passphrase", "correct horse battery staple", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, userInputs...)
+			var violation *Violation
+			if got := errors.As(err, &violation); got != tt.violation {
+				t.Errorf("Check(%q) = %v, want violation %v", tt.password, err, tt.violation)
+			}
+		})
+	}
+}
+
+func TestCheckBreached(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "correct horse battery staple" is ABF7AAD6438836DBE526AA231ABDE2D0EEF74D42
+	writeRange(t, dir, "ABF7A", "AD6438836DBE526AA231ABDE2D0EEF74D42:212\n")
+	policy := &Policy{MinLength: 8, Breached: &BreachedList{Dir: dir, MinCount: 1}}
+
+	err := policy.Check("correct horse battery staple")
+	var violation *Violation
+	if !errors.As(err, &violation) {
+		t.Errorf("Check of a breached password = %v, want a violation", err)
+	}
+}
+
+func TestBreachedListContains(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	writeRange(t, dir, "5BAA6", "0018A45C4D1DEF81644B54AB7F969B88D65:1\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:3\n")
+	// SHA-1 of "hunter2" is F3BBBD66A63D4BF1747940578EC3D0103530E21D
+	writeRange(t, dir, "F3BBB", "D66A63D4BF1747940578EC3D0103530E21D\n")
+	// SHA-1 of "letmein" is B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3
+	writeRange(t, dir, "B7A87", "0018A45C4D1DEF81644B54AB7F969B88D65:4\n")
+
+	tests := []struct {
+		name     string
+		password string
+		minCount int
+		want     bool
+	}{
+		{"listed, lower case suffix", "password", 1, true},
+		{"seen fewer times than the minimum", "password", 10, false},
+		{"listed without a count", "hunter2", 1, true},
+		{"prefix file without the suffix", "letmein", 1, false},
+		{"no prefix file", "kX9#mQ2$vL7!pR4", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := &BreachedList{Dir: dir, MinCount: tt.minCount}
+			got, err := list.Contains(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBreachedList(t *testing.T) {
+	dir := t.TempDir()
+	list, err := NewBreachedList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Dir != dir || list.MinCount != 1 {
+		t.Errorf("NewBreachedList = %+v", list)
+	}
+
+	if _, err := NewBreachedList(filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewBreachedList of a missing directory did not fail")
+	}
+}
+
+// writeRange writes a range file for the hash prefix.
+func writeRange(t *testing.T, dir, prefix, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
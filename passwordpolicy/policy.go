@@ -0,0 +1,80 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Violation is returned when a password does not meet the policy. Its
+// message is meant to be shown to the user.
+type Violation struct {
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Policy describes which passwords are accepted.
+type Policy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MinScore is the minimum strength score from 0 to 4, see Score.
+	MinScore int
+	// Breached rejects known breached passwords when set.
+	Breached *BreachedList
+}
+
+// Check returns a *Violation when the password is not acceptable. The user
+// inputs, such as the email address and name, must not appear in the
+// password. Other errors mean the breached password list could not be read.
+func (p *Policy) Check(password string, userInputs ...string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &Violation{Message: fmt.Sprintf("Password must be at least %d characters long.", p.MinLength)}
+	}
+
+	lower := strings.ToLower(password)
+	for _, input := range inputTokens(userInputs) {
+		if strings.Contains(lower, input) {
+			return &Violation{Message: "Password must not contain your name or email address."}
+		}
+	}
+
+	if Score(password, userInputs...) < p.MinScore {
+		return &Violation{Message: "Password is too easy to guess. Use a longer password or a few unrelated words."}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return &Violation{Message: "This password has appeared in a data breach. Please choose a different one."}
+		}
+	}
+
+	return nil
+}
+
+// inputTokens splits user inputs into lower case words long enough to be
+// worth checking. Only the local part of email addresses is used, so
+// "jane.doe@example.com" yields "jane" and "doe".
+func inputTokens(userInputs []string) []string {
+	var tokens []string
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		if at := strings.LastIndex(input, "@"); at >= 0 {
+			input = input[:at]
+		}
+		words := strings.FieldsFunc(input, func(r rune) bool {
+			return r == '.' || r == '_' || r == '-' || r == '+' || r == ' '
+		})
+		for _, word := range words {
+			if len(word) >= 3 {
+				tokens = append(tokens, word)
+			}
+		}
+	}
+	return tokens
+}
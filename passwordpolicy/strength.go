@@ -0,0 +1,161 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonWords are passwords and fragments attackers try first. Any of them
+// inside a password adds almost nothing to its strength.
+var commonWords = []string{
+	"password", "passw0rd", "qwerty", "azerty", "letmein", "welcome", "admin",
+	"login", "master", "dragon", "monkey", "shadow", "sunshine", "princess",
+	"football", "baseball", "soccer", "hockey", "batman", "superman", "trustno1",
+	"iloveyou", "secret", "hello", "freedom", "whatever", "starwars", "summer",
+	"winter", "spring", "autumn", "michael", "charlie", "jordan", "hunter",
+	"killer", "ninja", "mustang", "access", "flower", "cheese", "computer",
+	"internet", "google", "abc123", "123456", "654321", "111111", "000000",
+	"qazwsx", "asdfgh", "zxcvbn", "1q2w3e", "changeme", "default", "test",
+	"task", "todo", "manager",
+}
+
+// keyboardRows are used to spot walks along the keyboard such as "asdf".
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// Score estimates how hard the password is to guess, in the spirit of
+// zxcvbn: 0 is trivial, 1 weak, 2 fair, 3 strong and 4 very strong. Common
+// words, the user inputs, repeats, sequences and keyboard walks count for
+// little.
+func Score(password string, userInputs ...string) int {
+	bits := entropyBits(password, userInputs)
+	switch {
+	case bits < 30:
+		return 0
+	case bits < 45:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 75:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// entropyBits estimates the entropy of the password in bits.
+func entropyBits(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	// Each character starts with full weight
+	weights := make([]float64, len(runes))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	// Known words and the user's own details are guessed as a whole
+	lower := []rune(strings.ToLower(password))
+	words := append(append([]string{}, commonWords...), inputTokens(userInputs)...)
+	for _, word := range words {
+		discount(lower, []rune(word), weights)
+	}
+
+	// Repeats, sequences like "abc" or "321" and keyboard walks
+	for i := 1; i < len(lower); i++ {
+		if lower[i] == lower[i-1] || isSequence(lower, i) || isKeyboardWalk(lower, i) {
+			weights[i] = math.Min(weights[i], 0.2)
+		}
+	}
+
+	var length float64
+	for _, w := range weights {
+		length += w
+	}
+	return length * math.Log2(float64(poolSize(runes)))
+}
+
+// discount lowers the weight of every occurrence of word in the password to
+// one character in total.
+func discount(password, word []rune, weights []float64) {
+	if len(word) == 0 {
+		return
+	}
+	for i := 0; i+len(word) <= len(password); i++ {
+		if string(password[i:i+len(word)]) != string(word) {
+			continue
+		}
+		for j := i; j < i+len(word); j++ {
+			weights[j] = math.Min(weights[j], 1/float64(len(word)))
+		}
+	}
+}
+
+// isSequence reports whether the character at i continues an ascending or
+// descending run such as "abc" or "987".
+func isSequence(password []rune, i int) bool {
+	d := password[i] - password[i-1]
+	if d != 1 && d != -1 {
+		return false
+	}
+	// A single step is common by chance, require a run of three
+	return i >= 2 && password[i-1]-password[i-2] == d
+}
+
+// isKeyboardWalk reports whether the character at i is next to the one before
+// it on the same keyboard row.
+func isKeyboardWalk(password []rune, i int) bool {
+	for _, row := range keyboardRows {
+		prev := strings.IndexRune(row, password[i-1])
+		cur := strings.IndexRune(row, password[i])
+		if prev >= 0 && cur >= 0 && (cur-prev == 1 || prev-cur == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolSize returns the number of characters an attacker has to try for each
+// position, based on the character classes used.
+func poolSize(password []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
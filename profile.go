@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"task-manager-app/mailer"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"task-manager-app/render"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// UpdateProfileRequest is the body of PATCH /api/profile. Fields left out
+// are not changed.
+type UpdateProfileRequest struct {
+	FirstName *string `json:"firstname"`
+	LastName  *string `json:"lastname"`
+	Phone     *string `json:"phone"`
+	TimeZone  *string `json:"timezone"`
+	// WebhookURL receives webhook reminders, an empty string removes it.
+	WebhookURL *string `json:"webhook_url"`
+}
+
+// ChangePasswordRequest is the body of POST /api/profile/password. Accounts
+// without a password leave out current_password to set one.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangeEmailRequest is the body of POST /api/profile/email. The password is
+// left out by accounts that do not have one.
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password"`
+}
+
+var (
+	errPasswordIncorrect = errors.New("password is incorrect")
+	errLoginNotRecent    = errors.New("log in again to confirm this change")
+)
+
+// confirmIdentity checks that the caller may make a sensitive change to the
+// account. Users with a password confirm with it. Users without one, such as
+// those created through SSO, must have logged in to this session within
+// recentLoginWindow.
+func confirmIdentity(auth *middleware.Auth, password string) error {
+	if len(auth.User.Password) > 0 {
+		if bcrypt.CompareHashAndPassword(auth.User.Password, []byte(password)) != nil {
+			return errPasswordIncorrect
+		}
+		return nil
+	}
+
+	// API tokens cannot log in again
+	if auth.SessionID == uuid.Nil {
+		return errLoginNotRecent
+	}
+	var session models.Session
+	if err := db.Where("id = ?", auth.SessionID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errLoginNotRecent
+		}
+		return err
+	}
+	if time.Since(session.CreatedAt) > recentLoginWindow {
+		return errLoginNotRecent
+	}
+	return nil
+}
+
+// respondIdentityError answers a request whose identity check failed.
+func respondIdentityError(c *gin.Context, err error) {
+	switch err {
+	case errPasswordIncorrect:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errLoginNotRecent:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "login_required": true})
+	default:
+		log.Println("Error confirming identity:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// revokeOtherSessions revokes every session of the user except keep.
+func revokeOtherSessions(tx *gorm.DB, userID, keep uuid.UUID) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keep).
+		Update("revoked_at", time.Now()).Error
+}
+
+// emailTaken reports whether another account already uses the email address.
+func emailTaken(tx *gorm.DB, email string) (bool, error) {
+	var count int64
+	// Deleted accounts keep their address until they are purged
+	err := tx.Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func UpdateProfile(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.FirstName != nil {
+		updates["first_name"] = strings.TrimSpace(*req.FirstName)
+	}
+	if req.LastName != nil {
+		updates["last_name"] = strings.TrimSpace(*req.LastName)
+	}
+	if req.Phone != nil {
+		updates["phone"] = strings.TrimSpace(*req.Phone)
+	}
+	if req.TimeZone != nil {
+		// Due dates are shown and filtered in this zone
+		if _, err := loadLocation(*req.TimeZone); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "unknown time zone", "errors": gin.H{"timezone": "unknown time zone"}})
+			return
+		}
+		updates["time_zone"] = *req.TimeZone
+	}
+	if req.WebhookURL != nil {
+		webhookURL := strings.TrimSpace(*req.WebhookURL)
+		if webhookURL != "" && !validWebhookURL(webhookURL) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid webhook url", "errors": gin.H{"webhook_url": "must be an http or https URL"}})
+			return
+		}
+		updates["webhook_url"] = webhookURL
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		log.Println("Error updating profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
+	if err := db.Where("id = ?", user.ID).First(user).Error; err != nil {
+		log.Println("Error fetching user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func ChangePassword(c *gin.Context) {
+	auth := middleware.CurrentAuth(c)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	if err := confirmIdentity(auth, req.CurrentPassword); err == errPasswordIncorrect {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		return
+	} else if err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+
+	message, err := validatePassword(req.NewPassword, auth.User)
+	if err != nil {
+		log.Println("Error checking password policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if message != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "errors": gin.H{"new_password": message}})
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		log.Println("Error hashing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(auth.User).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		// Keep this device logged in, log out everywhere else
+		return revokeOtherSessions(tx, auth.User.ID, auth.SessionID)
+	})
+	if err != nil {
+		log.Println("Error changing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed, other sessions have been logged out"})
+}
+
+func RequestEmailChange(c *gin.Context) {
+	auth := middleware.CurrentAuth(c)
+	user := auth.User
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a valid new_email is required"})
+		return
+	}
+	newEmail := strings.TrimSpace(req.NewEmail)
+
+	if err := confirmIdentity(auth, req.Password); err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "this is already your email address"})
+		return
+	}
+
+	taken, err := emailTaken(db, newEmail)
+	if err != nil {
+		log.Println("Error checking email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists. Please use a different email address."})
+		return
+	}
+
+	token, err := issueUserToken(user.ID, models.PurposeEmailChange, newEmail, emailVerificationTTL)
+	if err != nil {
+		log.Println("Error creating email change token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// The address only switches once the new owner confirms it
+	link := appURL + "/profile/email/confirm?token=" + url.QueryEscape(token)
+	if err := mail.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Open the link below to use this address for your account. It expires in " + emailVerificationTTL.String() + ".\n\n" +
+			link + "\n",
+	}); err != nil {
+		log.Println("Error sending email change confirmation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "check your new email address to confirm the change"})
+}
+
+func ConfirmEmailChange(c *gin.Context) {
+	var user models.User
+	var oldEmail, newEmail string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record, err := redeemUserToken(tx, c.Query("token"), models.PurposeEmailChange)
+		if err != nil {
+			return err
+		}
+
+		// Someone may have registered the address in the meantime
+		taken, err := emailTaken(tx, record.Data)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errInvalidUserToken
+		}
+
+		if err := tx.Where("id = ?", record.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		oldEmail, newEmail = user.Email, record.Data
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email":             newEmail,
+			"email_verified_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		if err != errInvalidUserToken {
+			log.Println("Error confirming email change:", err)
+		}
+		render.RenderTemplate(c, "verify_email", gin.H{
+			"Success": false,
+			"Message": "This confirmation link is invalid or has expired.",
+		})
+		return
+	}
+
+	// Let the previous address know in case the change was not wanted
+	if err := mail.Send(mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"The email address of your account was changed to " + newEmail + ".\n" +
+			"If you did not make this change, reset your password and contact support.\n",
+	}); err != nil {
+		log.Println("Error sending email change notice:", err)
+	}
+
+	render.RenderTemplate(c, "verify_email", gin.H{
+		"Success": true,
+		"Message": "Your email address has been changed.",
+	})
+}
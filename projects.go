@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxProjectNameLength = 100
+	maxProjectIconLength = 32
+	defaultProjectColor  = "#6c757d"
+)
+
+var (
+	errProjectNotFound = errors.New("project not found")
+	errInboxDelete     = errors.New("the inbox cannot be deleted")
+	colorPattern       = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// projectIndexes make sure every user has at most one Inbox.
+var projectIndexes = []string{
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_user_inbox ON projects (user_id) WHERE inbox",
+}
+
+// ProjectRequest is the body of POST /api/projects and PUT
+// /api/projects/:id. Fields left out are not changed.
+type ProjectRequest struct {
+	Name      *string `json:"name"`
+	Color     *string `json:"color"`
+	Icon      *string `json:"icon"`
+	Archived  *bool   `json:"archived"`
+	SortOrder *int    `json:"sort_order"`
+}
+
+// ensureInbox returns the user's Inbox project, creating it if the user has none yet.
+func ensureInbox(tx *gorm.DB, userID uuid.UUID) (*models.Project, error) {
+	var inbox models.Project
+	err := tx.Where("user_id = ? AND inbox = ?", userID, true).First(&inbox).Error
+	if err == nil {
+		return &inbox, nil
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	inbox = models.Project{
+		ID:     uuid.New(),
+		UserID: userID,
+		Name:   models.InboxName,
+		Color:  defaultProjectColor,
+		Inbox:  true,
+	}
+	// A concurrent request may create the Inbox first, idx_projects_user_inbox
+	// then makes the insert a no-op and the lookup finds theirs
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&inbox)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var existing models.Project
+		if err := tx.Where("user_id = ? AND inbox = ?", userID, true).First(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	// Tasks created before projects existed belong to the Inbox
+	if err := tx.Model(&models.Task{}).Where("user_id = ? AND project_id IS NULL", userID).
+		Update("project_id", inbox.ID).Error; err != nil {
+		return nil, err
+	}
+	return &inbox, nil
+}
+
+// findProject loads a project of the user, failing with errProjectNotFound
+// for unknown IDs and projects of other users.
+func findProject(tx *gorm.DB, userID uuid.UUID, id string) (*models.Project, error) {
+	projectID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errProjectNotFound
+	}
+
+	var project models.Project
+	if err := tx.Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errProjectNotFound
+		}
+		return nil, err
+	}
+	return &project, nil
+}
+
+// applyProjectRequest validates the request and copies it onto the project.
+// It returns a message for each invalid field.
+func applyProjectRequest(project *models.Project, req *ProjectRequest) map[string]string {
+	fieldErrors := map[string]string{}
+
+	if req.Name != nil {
+		project.Name = strings.TrimSpace(*req.Name)
+	}
+	if project.Name == "" {
+		fieldErrors["name"] = "name is required"
+	} else if len(project.Name) > maxProjectNameLength {
+		fieldErrors["name"] = "name is too long"
+	}
+	if req.Color != nil {
+		if !colorPattern.MatchString(*req.Color) {
+			fieldErrors["color"] = "color must look like #1a2b3c"
+		}
+		project.Color = strings.ToLower(*req.Color)
+	}
+	if req.Icon != nil {
+		if len(*req.Icon) > maxProjectIconLength {
+			fieldErrors["icon"] = "icon is too long"
+		}
+		project.Icon = *req.Icon
+	}
+	if req.Archived != nil {
+		if project.Inbox && *req.Archived {
+			fieldErrors["archived"] = "the Inbox cannot be archived"
+		}
+		project.Archived = *req.Archived
+	}
+	if req.SortOrder != nil {
+		project.SortOrder = *req.SortOrder
+	}
+
+	return fieldErrors
+}
+
+func ListProjects(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	if _, err := ensureInbox(db, user.ID); err != nil {
+		log.Println("Error creating inbox:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
+		return
+	}
+
+	// Archived projects are hidden unless asked for
+	query := db.Where("user_id = ?", user.ID)
+	if c.Query("archived") != "true" {
+		query = query.Where("archived = ?", false)
+	}
+
+	var projects []models.Project
+	if err := query.Order("inbox DESC, sort_order, created_at").Find(&projects).Error; err != nil {
+		log.Println("Error fetching projects:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": projects})
+}
+
+func GetProject(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	project, err := findProject(db, user.ID, c.Param("id"))
+	if err == errProjectNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func CreateProject(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	project := models.Project{ID: uuid.New(), UserID: user.ID, Color: defaultProjectColor}
+	if fieldErrors := applyProjectRequest(&project, &req); len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid project", "errors": fieldErrors})
+		return
+	}
+
+	// New projects go to the end of the list unless placed explicitly
+	if req.SortOrder == nil {
+		var last struct{ Max int }
+		if err := db.Model(&models.Project{}).Select("COALESCE(MAX(sort_order), 0) AS max").
+			Where("user_id = ?", user.ID).Scan(&last).Error; err != nil {
+			log.Println("Error fetching project order:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+			return
+		}
+		project.SortOrder = last.Max + 1
+	}
+
+	if err := db.Create(&project).Error; err != nil {
+		log.Println("Error creating project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+func UpdateProject(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	project, err := findProject(db, user.ID, c.Param("id"))
+	if err == errProjectNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update project"})
+		return
+	}
+
+	var req ProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+	if fieldErrors := applyProjectRequest(project, &req); len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid project", "errors": fieldErrors})
+		return
+	}
+
+	if err := db.Save(project).Error; err != nil {
+		log.Println("Error updating project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject moves a project to the trash together with its tasks.
+func DeleteProject(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		project, err := findProject(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		if project.Inbox {
+			return errInboxDelete
+		}
+		return trashProject(tx, project)
+	})
+	if err == errProjectNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err == errInboxDelete {
+		c.JSON(http.StatusConflict, gin.H{"error": "the Inbox cannot be deleted"})
+		return
+	} else if err != nil {
+		log.Println("Error deleting project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "project moved to the trash with its tasks"})
+}
+
+// ListProjectTasks lists the tasks of one project with the filters of GetAllTasks.
+func ListProjectTasks(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	project, err := findProject(db, user.ID, c.Param("id"))
+	if err == errProjectNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+		return
+	}
+
+	listTasks(c, db.Where("user_id = ? AND project_id = ?", user.ID, project.ID))
+}
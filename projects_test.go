@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestEnsureInboxCreatedConcurrently(t *testing.T) {
+	mock := mockDB(t)
+	userID := uuid.New()
+	inboxID := uuid.New()
+
+	mock.ExpectQuery(`SELECT \* FROM "projects" WHERE \(user_id = \$1 AND inbox = \$2\)`).
+		WithArgs(userID, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// Another request created the Inbox in between
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "projects" .* ON CONFLICT DO NOTHING`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "projects" WHERE \(user_id = \$1 AND inbox = \$2\)`).
+		WithArgs(userID, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "inbox"}).AddRow(inboxID, userID, "Inbox", true))
+
+	inbox, err := ensureInbox(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inbox.ID != inboxID {
+		t.Errorf("got Inbox %s, want the existing %s", inbox.ID, inboxID)
+	}
+}
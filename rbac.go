@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errAccountDisabled = errors.New("account is disabled")
+
+// rolePermissions returns the permissions granted by a built-in or custom role.
+func rolePermissions(name string) ([]string, error) {
+	if name == "" {
+		name = models.RoleUser
+	}
+	if permissions, ok := models.BuiltInRoles[name]; ok {
+		return permissions, nil
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// A deleted custom role grants nothing
+			return nil, nil
+		}
+		return nil, err
+	}
+	return role.PermissionList(), nil
+}
+
+// newAuth describes an authenticated user, refusing disabled accounts.
+func newAuth(user *models.User, sessionID uuid.UUID, scopes []string) (*middleware.Auth, error) {
+	if user.DisabledAt != nil {
+		return nil, errAccountDisabled
+	}
+
+	permissions, err := rolePermissions(user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &middleware.Auth{User: user, SessionID: sessionID, Scopes: scopes, Permissions: permissions}, nil
+}
+
+// validPermission reports whether permission can be granted to a role.
+func validPermission(permission string) bool {
+	for _, p := range models.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// roleExists reports whether name is a built-in or custom role.
+func roleExists(name string) (bool, error) {
+	if _, ok := models.BuiltInRoles[name]; ok {
+		return true, nil
+	}
+	var count int64
+	err := db.Model(&models.Role{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+// promoteAdmins gives the admin role to the users listed in ADMIN_EMAILS so
+// that a fresh installation has someone who can manage it.
+func promoteAdmins() {
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		if err := db.Model(&models.User{}).Where("email = ?", email).Update("role", models.RoleAdmin).Error; err != nil {
+			log.Println("Error promoting admin "+email+":", err)
+		}
+	}
+}
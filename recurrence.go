@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"task-manager-app/rrule"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// recurrencePresets are shorthands accepted in place of an RRULE.
+var recurrencePresets = map[string]string{
+	"daily":    "FREQ=DAILY",
+	"weekdays": "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	"weekly":   "FREQ=WEEKLY",
+	"monthly":  "FREQ=MONTHLY",
+	"yearly":   "FREQ=YEARLY",
+}
+
+var (
+	errSeriesEnded  = errors.New("the series has no further occurrences")
+	errNotRecurring = errors.New("the task does not repeat")
+)
+
+// normalizeRecurrence validates a preset or RRULE and returns the rule in
+// canonical form. An empty value means the task does not repeat.
+func normalizeRecurrence(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if preset, ok := recurrencePresets[strings.ToLower(value)]; ok {
+		value = preset
+	}
+	rule, err := rrule.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+// currentOccurrence returns the number of the task within its series, tasks
+// that repeat since before series were numbered are the first.
+func currentOccurrence(task *models.Task) int {
+	if task.Occurrence < 1 {
+		return 1
+	}
+	return task.Occurrence
+}
+
+// nextOccurrenceTimes returns the start and due date of the occurrence after
+// the task. Dates move by the rule from the due date (or the start date when
+// there is none), or from now when the task repeats from completion. The gap
+// between start and due date is kept.
+func nextOccurrenceTimes(task *models.Task, now time.Time) (*time.Time, *time.Time, error) {
+	rule, err := rrule.Parse(task.Recurrence)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rule.Count > 0 && currentOccurrence(task) >= rule.Count {
+		return nil, nil, errSeriesEnded
+	}
+
+	loc, err := loadLocation(task.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	anchor := task.DueAt
+	if anchor == nil {
+		anchor = task.StartAt
+	}
+	var base time.Time
+	switch {
+	case anchor != nil && task.RepeatFrom != models.RepeatFromCompletion:
+		base = *anchor
+	case task.AllDay:
+		base = startOfDay(now, loc)
+	case anchor != nil:
+		// Completed today, the next occurrence keeps the time of day
+		local := now.In(loc)
+		h, m, s := anchor.In(loc).Clock()
+		base = time.Date(local.Year(), local.Month(), local.Day(), h, m, s, 0, loc)
+	default:
+		base = now
+	}
+
+	next, ok := rule.Next(base, base, loc)
+	if !ok {
+		return nil, nil, errSeriesEnded
+	}
+
+	switch {
+	case task.DueAt == nil && task.StartAt != nil:
+		return &next, nil, nil
+	case task.DueAt == nil || task.StartAt == nil:
+		return nil, &next, nil
+	}
+
+	var start time.Time
+	if task.AllDay {
+		// Whole days, an hour more or less around DST changes does not matter
+		days := int(math.Round(task.DueAt.Sub(*task.StartAt).Hours() / 24))
+		start = time.Date(next.Year(), next.Month(), next.Day()-days, 0, 0, 0, 0, loc)
+	} else {
+		start = next.Add(-task.DueAt.Sub(*task.StartAt))
+	}
+	return &start, &next, nil
+}
+
+// createNextOccurrence creates the occurrence following the task with the
+// same details, labels, relative reminders and an unchecked copy of its checklist. The task
+// itself stops driving the series. It returns nil when the series has ended.
+func createNextOccurrence(tx *gorm.DB, task *models.Task, now time.Time) (*models.Task, error) {
+	start, due, err := nextOccurrenceTimes(task, now)
+	if err == errSeriesEnded {
+		return nil, tx.Model(task).Update("recurrence", "").Error
+	} else if err != nil {
+		return nil, err
+	}
+
+	seriesID := task.ID
+	if task.SeriesID != nil {
+		seriesID = *task.SeriesID
+	}
+	occurrence := currentOccurrence(task)
+
+	next := models.Task{
+		ID:           uuid.New(),
+		UserID:       task.UserID,
+		Title:        task.Title,
+		Description:  task.Description,
+		Status:       models.Pending,
+		Priority:     task.Priority,
+		StartAt:      start,
+		DueAt:        due,
+		AllDay:       task.AllDay,
+		TimeZone:     task.TimeZone,
+		ProjectID:    task.ProjectID,
+		ParentID:     task.ParentID,
+		AutoComplete: task.AutoComplete,
+		Recurrence:   task.Recurrence,
+		RepeatFrom:   task.RepeatFrom,
+		SeriesID:     &seriesID,
+		Occurrence:   occurrence + 1,
+	}
+	if err := tx.Create(&next).Error; err != nil {
+		return nil, err
+	}
+
+	if err := copyReminders(tx, task, &next); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Exec("INSERT INTO task_labels (task_id, label_id) SELECT ?, label_id FROM task_labels WHERE task_id = ?",
+		next.ID, task.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var items []models.ChecklistItem
+	if err := tx.Where("task_id = ?", task.ID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].ID = uuid.New()
+		items[i].TaskID = next.ID
+		items[i].Done = false
+	}
+	if len(items) > 0 {
+		if err := tx.Create(&items).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(task).Updates(map[string]interface{}{
+		"recurrence": "",
+		"series_id":  seriesID,
+		"occurrence": occurrence,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// SkipOccurrence moves a recurring task to its next occurrence without
+// completing it.
+func SkipOccurrence(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var task *models.Task
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if task, err = findTask(tx, user.ID, c.Param("id")); err != nil {
+			return err
+		}
+		if task.Recurrence == "" {
+			return errNotRecurring
+		}
+
+		start, due, err := nextOccurrenceTimes(task, time.Now())
+		if err != nil {
+			return err
+		}
+		task.StartAt, task.DueAt = start, due
+		task.Occurrence = currentOccurrence(task) + 1
+		if task.SeriesID == nil {
+			task.SeriesID = &task.ID
+		}
+		if err := tx.Save(task).Error; err != nil {
+			return err
+		}
+		if err := rescheduleReminders(tx, task, time.Now()); err != nil {
+			return err
+		}
+		return tx.Model(&models.ChecklistItem{}).Where("task_id = ?", task.ID).Update("done", false).Error
+	})
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err == errNotRecurring || err == errSeriesEnded {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error skipping occurrence:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to skip occurrence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// EndSeries stops a recurring task from repeating, the task itself is kept.
+func EndSeries(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	task, err := findTask(db, user.ID, c.Param("id"))
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end series"})
+		return
+	}
+	if task.Recurrence == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": errNotRecurring.Error()})
+		return
+	}
+
+	if err := db.Model(task).Update("recurrence", "").Error; err != nil {
+		log.Println("Error ending series:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
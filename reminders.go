@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"task-manager-app/notify"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxRemindersPerTask = 10
+	// maxReminderOffset is how long before the due date a reminder can be, in minutes.
+	maxReminderOffset   = 60 * 24 * 365
+	maxReminderAttempts = 5
+	reminderBatchSize   = 100
+	notificationsLimit  = 100
+)
+
+var (
+	errReminderNotFound     = errors.New("reminder not found")
+	errNotificationNotFound = errors.New("notification not found")
+)
+
+var (
+	// notifiers deliver reminders, keyed by channel
+	notifiers            map[string]notify.Notifier
+	reminderPollInterval time.Duration
+	reminderMaxDelay     time.Duration
+	reminderClaimTimeout time.Duration
+)
+
+// reminderIndexes speed up finding reminders that are due.
+var reminderIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_reminders_pending ON reminders ((COALESCE(next_attempt_at, remind_at))) WHERE sent_at IS NULL",
+}
+
+// ReminderRequest is the body of POST /api/tasks/:id/reminders. Exactly one
+// of remind_at and offset_minutes must be given.
+type ReminderRequest struct {
+	// RemindAt is an RFC 3339 time or a local time in the task's time zone.
+	RemindAt *string `json:"remind_at"`
+	// OffsetMinutes is how long before the due date to remind.
+	OffsetMinutes *int   `json:"offset_minutes"`
+	Channel       string `json:"channel"`
+}
+
+// setupNotifiers configures the reminder channels and scheduler from the
+// environment.
+func setupNotifiers() {
+	notifiers = map[string]notify.Notifier{
+		models.ChannelEmail: &notify.EmailNotifier{Mailer: mail},
+		models.ChannelWebhook: &notify.WebhookNotifier{
+			Client: notify.NewWebhookClient(durationFromEnv("REMINDER_WEBHOOK_TIMEOUT", 10*time.Second)),
+			Secret: os.Getenv("REMINDER_WEBHOOK_SECRET"),
+		},
+		models.ChannelInApp: &notify.InAppNotifier{},
+	}
+
+	// How often pending reminders are looked for, and how late they may still go out
+	reminderPollInterval = durationFromEnv("REMINDER_POLL_INTERVAL", 30*time.Second)
+	reminderMaxDelay = durationFromEnv("REMINDER_MAX_DELAY", 24*time.Hour)
+	// How long claimed reminders are left to the replica that claimed them
+	// before others retry them, it must cover delivering a whole batch
+	reminderClaimTimeout = durationFromEnv("REMINDER_CLAIM_TIMEOUT", 30*time.Minute)
+}
+
+// validWebhookURL reports whether a webhook URL is an absolute http(s) URL
+// that does not obviously point at an internal host. Names are checked again
+// when connecting, after they are resolved.
+func validWebhookURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return notify.PublicIP(ip)
+	}
+	return true
+}
+
+// relativeReminderTime returns when a reminder offset minutes before the due date fires.
+func relativeReminderTime(dueAt *time.Time, offset int) *time.Time {
+	if dueAt == nil {
+		return nil
+	}
+	t := dueAt.Add(-time.Duration(offset) * time.Minute)
+	return &t
+}
+
+// rescheduleReminders moves the relative reminders of the task to its
+// current due date. Reminders moved into the future go out again, reminders
+// of tasks without a due date wait until one is set.
+func rescheduleReminders(tx *gorm.DB, task *models.Task, now time.Time) error {
+	var reminders []models.Reminder
+	if err := tx.Where("task_id = ? AND offset_minutes IS NOT NULL", task.ID).Find(&reminders).Error; err != nil {
+		return err
+	}
+
+	for i := range reminders {
+		reminder := &reminders[i]
+		at := relativeReminderTime(task.DueAt, *reminder.OffsetMinutes)
+		if (at == nil && reminder.RemindAt == nil) || (at != nil && reminder.RemindAt != nil && at.Equal(*reminder.RemindAt)) {
+			continue
+		}
+		reminder.RemindAt = at
+		// Without a due date there is nothing to remind of, pending retries are dropped
+		if at == nil || at.After(now) {
+			reminder.SentAt = nil
+			reminder.Attempts = 0
+			reminder.NextAttemptAt = nil
+			reminder.LastError = ""
+		}
+		if err := tx.Save(reminder).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyReminders gives the next occurrence of a recurring task the relative
+// reminders of the previous one. Reminders at fixed times are not repeated.
+func copyReminders(tx *gorm.DB, from, to *models.Task) error {
+	var reminders []models.Reminder
+	if err := tx.Where("task_id = ? AND offset_minutes IS NOT NULL", from.ID).Find(&reminders).Error; err != nil {
+		return err
+	}
+	for i := range reminders {
+		copied := models.Reminder{
+			ID:            uuid.New(),
+			TaskID:        to.ID,
+			UserID:        to.UserID,
+			Channel:       reminders[i].Channel,
+			OffsetMinutes: reminders[i].OffsetMinutes,
+			RemindAt:      relativeReminderTime(to.DueAt, *reminders[i].OffsetMinutes),
+		}
+		if err := tx.Create(&copied).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ListReminders(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	task, err := findTask(db, user.ID, c.Param("id"))
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reminders"})
+		return
+	}
+
+	var reminders []models.Reminder
+	if err := db.Where("task_id = ?", task.ID).Order("remind_at NULLS LAST, created_at").Find(&reminders).Error; err != nil {
+		log.Println("Error fetching reminders:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reminders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": reminders})
+}
+
+func CreateReminder(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	task, err := findTask(db, user.ID, c.Param("id"))
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reminder"})
+		return
+	}
+
+	var req ReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	reminder := models.Reminder{ID: uuid.New(), TaskID: task.ID, UserID: user.ID, Channel: req.Channel}
+	fieldErrors := map[string]string{}
+	if reminder.Channel == "" {
+		reminder.Channel = models.ChannelInApp
+	}
+	if _, ok := notifiers[reminder.Channel]; !ok {
+		fieldErrors["channel"] = "channel must be email, webhook or in_app"
+	} else if reminder.Channel == models.ChannelWebhook && user.WebhookURL == "" {
+		fieldErrors["channel"] = "set a webhook_url in your profile first"
+	}
+
+	switch {
+	case (req.RemindAt == nil) == (req.OffsetMinutes == nil):
+		fieldErrors["remind_at"] = "give either remind_at or offset_minutes"
+	case req.RemindAt != nil:
+		loc, err := loadLocation(task.TimeZone)
+		if err != nil {
+			loc = time.UTC
+		}
+		at, ok := parseTaskTime(*req.RemindAt, false, loc)
+		if !ok || at == nil {
+			fieldErrors["remind_at"] = "must be an RFC 3339 time"
+		}
+		reminder.RemindAt = at
+	default:
+		if *req.OffsetMinutes < 0 || *req.OffsetMinutes > maxReminderOffset {
+			fieldErrors["offset_minutes"] = "offset_minutes must be between 0 and one year"
+		}
+		reminder.OffsetMinutes = req.OffsetMinutes
+		reminder.RemindAt = relativeReminderTime(task.DueAt, *req.OffsetMinutes)
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid reminder", "errors": fieldErrors})
+		return
+	}
+
+	var count int64
+	if err := db.Model(&models.Reminder{}).Where("task_id = ?", task.ID).Count(&count).Error; err != nil {
+		log.Println("Error counting reminders:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reminder"})
+		return
+	}
+	if count >= maxRemindersPerTask {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "a task can have at most 10 reminders"})
+		return
+	}
+
+	if err := db.Create(&reminder).Error; err != nil {
+		log.Println("Error creating reminder:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reminder"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, reminder)
+}
+
+func DeleteReminder(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		task, err := findTask(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		reminderID, err := uuid.Parse(c.Param("reminder"))
+		if err != nil {
+			return errReminderNotFound
+		}
+		result := tx.Where("id = ? AND task_id = ?", reminderID, task.ID).Delete(&models.Reminder{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReminderNotFound
+		}
+		return nil
+	})
+	if err == errTaskNotFound || err == errReminderNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error deleting reminder:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete reminder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "reminder deleted"})
+}
+
+// ListNotifications returns the latest in-app notifications, only unread
+// ones with ?unread=true.
+func ListNotifications(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	query := db.Where("user_id = ?", user.ID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(notificationsLimit).Find(&notifications).Error; err != nil {
+		log.Println("Error fetching notifications:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": notifications})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errNotificationNotFound.Error()})
+		return
+	}
+	// Notifications read before keep their first read time
+	result := db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", id, user.ID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if result.Error != nil {
+		log.Println("Error updating notification:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": errNotificationNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notification marked as read"})
+}
+
+// reminderMessage describes the task of a reminder in the user's time zone.
+func reminderMessage(task *models.Task, user *models.User) (string, string) {
+	title := "Reminder: " + task.Title
+	if task.DueAt == nil {
+		return title, task.Title
+	}
+	if task.AllDay {
+		loc, err := loadLocation(task.TimeZone)
+		if err != nil {
+			loc = time.UTC
+		}
+		return title, task.Title + " is due on " + task.DueAt.In(loc).Format("Monday, January 2")
+	}
+	return title, task.Title + " is due " + task.DueAt.In(userLocation(user)).Format("Monday, January 2 at 15:04 MST")
+}
+
+// deliverReminder sends one reminder and records the outcome on it. Failed
+// deliveries are retried with a growing delay.
+func deliverReminder(tx *gorm.DB, reminder *models.Reminder, now time.Time) {
+	var task models.Task
+	var user models.User
+	err := tx.Where("id = ?", reminder.TaskID).First(&task).Error
+	if err == nil {
+		err = tx.Where("id = ?", reminder.UserID).First(&user).Error
+	}
+
+	switch {
+	case err != nil:
+		reminder.LastError = err.Error()
+	case task.Status == models.Completed || task.Status == models.Canceled:
+		reminder.LastError = "skipped, the task is closed"
+	case user.DisabledAt != nil:
+		reminder.LastError = "skipped, the account is inactive"
+	case reminder.RemindAt == nil:
+		// The due date was cleared after the reminder was picked up
+		reminder.LastError = "skipped, the task has no due date"
+	case now.Sub(*reminder.RemindAt) > reminderMaxDelay:
+		// Reminders missed during a long outage are dropped rather than sent late
+		reminder.LastError = "skipped, too late"
+	default:
+		title, body := reminderMessage(&task, &user)
+		err = notifiers[reminder.Channel].Notify(tx, notify.Notification{
+			User:    &user,
+			Task:    &task,
+			Title:   title,
+			Body:    body,
+			SentAt:  now,
+			TaskURL: appURL + "/todo",
+		})
+		if err != nil {
+			reminder.Attempts++
+			reminder.LastError = err.Error()
+			retry := now.Add(time.Duration(reminder.Attempts*reminder.Attempts) * time.Minute)
+			reminder.NextAttemptAt = &retry
+			return
+		}
+		reminder.LastError = ""
+	}
+	reminder.SentAt = &now
+	reminder.NextAttemptAt = nil
+}
+
+// claimReminders picks up to reminderBatchSize due reminders and pushes their
+// next attempt past the claim timeout, so other replicas skip them while they
+// are delivered. The rows are only locked while claiming.
+func claimReminders(now time.Time) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND remind_at IS NOT NULL AND attempts < ? AND COALESCE(next_attempt_at, remind_at) <= ?", maxReminderAttempts, now).
+			// Reminders of trashed tasks and deleted users wait in case they are restored
+			Where("task_id IN (SELECT id FROM tasks WHERE deleted_at IS NULL)").
+			Where("user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)").
+			Order("COALESCE(next_attempt_at, remind_at)").
+			Limit(reminderBatchSize).
+			Find(&reminders).Error; err != nil {
+			return err
+		}
+		if len(reminders) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(reminders))
+		for i := range reminders {
+			ids[i] = reminders[i].ID
+		}
+		return tx.Model(&models.Reminder{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(reminderClaimTimeout)).Error
+	})
+	return reminders, err
+}
+
+// dispatchReminderBatch delivers up to reminderBatchSize due reminders. Each
+// delivery is recorded in its own transaction together with the in-app
+// notification it creates. Reminders rescheduled in the meantime are left
+// as they are.
+func dispatchReminderBatch(now time.Time) (int, error) {
+	reminders, err := claimReminders(now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range reminders {
+		reminder := &reminders[i]
+		remindAt := *reminder.RemindAt
+		err := db.Transaction(func(tx *gorm.DB) error {
+			deliverReminder(tx, reminder, now)
+			return tx.Model(reminder).Where("remind_at = ?", remindAt).
+				Select("sent_at", "attempts", "next_attempt_at", "last_error").Updates(reminder).Error
+		})
+		if err != nil {
+			// The claim runs out and the reminder is tried again
+			log.Println("Error recording reminder delivery:", err)
+		}
+	}
+	return len(reminders), nil
+}
+
+// dispatchReminders delivers every reminder that is due.
+func dispatchReminders() {
+	for {
+		count, err := dispatchReminderBatch(time.Now())
+		if err != nil {
+			log.Println("Error dispatching reminders:", err)
+			return
+		}
+		if count < reminderBatchSize {
+			return
+		}
+	}
+}
+
+// startReminderScheduler delivers due reminders now and then every interval.
+func startReminderScheduler(interval time.Duration) {
+	go func() {
+		for {
+			dispatchReminders()
+			time.Sleep(interval)
+		}
+	}()
+}
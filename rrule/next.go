@@ -0,0 +1,230 @@
+package rrule
+
+import "time"
+
+// maxPeriods bounds the search for the next occurrence, rules such as
+// "every February 29th on a Monday" only match every few decades.
+const maxPeriods = 10000
+
+// Next returns the first occurrence of the series starting at start that
+// comes after the given time, evaluated in loc. It returns false when the
+// series has ended. Count is not applied, the caller knows how many
+// occurrences came before.
+func (r *Rule) Next(start, after time.Time, loc *time.Location) (time.Time, bool) {
+	start = start.In(loc)
+	until := r.until(loc)
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.expand(start, period*r.Interval, loc) {
+			if t.Before(start) || !t.After(after) {
+				continue
+			}
+			if !until.IsZero() && t.After(until) {
+				return time.Time{}, false
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// until returns the last moment of the series in loc, zero when it has none.
+func (r *Rule) until(loc *time.Location) time.Time {
+	if r.UntilDate {
+		y, m, d := r.Until.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+	}
+	return r.Until
+}
+
+// expand returns the sorted occurrences of the period that lies offset
+// periods after the one containing start.
+func (r *Rule) expand(start time.Time, offset int, loc *time.Location) []time.Time {
+	h, mi, s := start.Clock()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, h, mi, s, 0, loc)
+	}
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		day := at(start.Year(), start.Month(), start.Day()+offset)
+		if r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	case Weekly:
+		weekStart := start.Day() - (int(start.Weekday())-int(r.WeekStart)+7)%7 + offset*7
+		weekdays := []Weekday{{Day: start.Weekday()}}
+		if len(r.ByDay) > 0 {
+			weekdays = r.ByDay
+		}
+		for _, wd := range weekdays {
+			days = append(days, at(start.Year(), start.Month(), weekStart+(int(wd.Day)-int(r.WeekStart)+7)%7))
+		}
+	case Monthly:
+		first := at(start.Year(), start.Month()+time.Month(offset), 1)
+		for _, d := range r.monthDays(first.Year(), first.Month(), start.Day()) {
+			days = append(days, at(first.Year(), first.Month(), d))
+		}
+	case Yearly:
+		year := start.Year() + offset
+		switch {
+		case len(r.ByMonth) > 0:
+			for _, m := range r.ByMonth {
+				for _, d := range r.monthDays(year, m, start.Day()) {
+					days = append(days, at(year, m, d))
+				}
+			}
+		case len(r.ByMonthDay) > 0:
+			// Month days without months repeat in every month
+			for m := time.January; m <= time.December; m++ {
+				for _, d := range r.monthDays(year, m, start.Day()) {
+					days = append(days, at(year, m, d))
+				}
+			}
+		case len(r.ByDay) > 0:
+			// Ordinals count within the year, such as the 20th Monday
+			for _, d := range nthWeekdays(year, time.January, 1, daysInYear(year), r.ByDay) {
+				days = append(days, at(year, time.January, d))
+			}
+		default:
+			if start.Day() <= daysIn(year, start.Month()) {
+				days = append(days, at(year, start.Month(), start.Day()))
+			}
+		}
+	}
+
+	// BYMONTH limits the occurrences of daily, weekly and monthly rules
+	if r.Freq != Yearly && len(r.ByMonth) > 0 {
+		kept := days[:0]
+		for _, day := range days {
+			if r.matchesMonth(day) {
+				kept = append(kept, day)
+			}
+		}
+		days = kept
+	}
+
+	days = sortTimes(days)
+	if len(r.BySetPos) > 0 {
+		days = selectPositions(days, r.BySetPos)
+	}
+	return days
+}
+
+// monthDays returns the days of a month matching BYMONTHDAY and BYDAY, or
+// the given day when the rule has neither.
+func (r *Rule) monthDays(year int, month time.Month, day int) []int {
+	n := daysIn(year, month)
+	switch {
+	case len(r.ByMonthDay) > 0:
+		var days []int
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d += n + 1
+			}
+			if d < 1 || d > n {
+				continue
+			}
+			if len(r.ByDay) > 0 && !containsInt(nthWeekdays(year, month, 1, n, r.ByDay), d) {
+				continue
+			}
+			days = append(days, d)
+		}
+		return days
+	case len(r.ByDay) > 0:
+		return nthWeekdays(year, month, 1, n, r.ByDay)
+	case day <= n:
+		return []int{day}
+	}
+	// Months without that day, such as February 30th, are skipped
+	return nil
+}
+
+// nthWeekdays returns the days from first to last that match one of the
+// weekdays, counting ordinals from the start or, when negative, the end.
+// Days are numbered from the first of the given month.
+func nthWeekdays(year int, month time.Month, first, last int, weekdays []Weekday) []int {
+	var days []int
+	for _, wd := range weekdays {
+		var matches []int
+		for d := first; d <= last; d++ {
+			if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == wd.Day {
+				matches = append(matches, d)
+			}
+		}
+		switch {
+		case wd.N == 0:
+			days = append(days, matches...)
+		case wd.N > 0 && wd.N <= len(matches):
+			days = append(days, matches[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(matches):
+			days = append(days, matches[len(matches)+wd.N])
+		}
+	}
+	return days
+}
+
+// selectPositions keeps the occurrences at the BYSETPOS positions, counted
+// from 1 or from the end when negative.
+func selectPositions(days []time.Time, positions []int) []time.Time {
+	var selected []time.Time
+	for _, pos := range positions {
+		if pos > 0 && pos <= len(days) {
+			selected = append(selected, days[pos-1])
+		} else if pos < 0 && -pos <= len(days) {
+			selected = append(selected, days[len(days)+pos])
+		}
+	}
+	return sortTimes(selected)
+}
+
+func (r *Rule) matchesMonth(t time.Time) bool {
+	for _, m := range r.ByMonth {
+		if t.Month() == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	n := daysIn(t.Year(), t.Month())
+	for _, d := range r.ByMonthDay {
+		if t.Day() == d || t.Day() == d+n+1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if t.Weekday() == wd.Day {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func daysInYear(year int) int {
+	return time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ of a rule.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// untilLayout is the UTC form of UNTIL, untilDateLayout its date-only form.
+const (
+	untilLayout     = "20060102T150405Z"
+	untilDateLayout = "20060102"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Weekday is a BYDAY entry such as MO, or 2TU and -1FR with an ordinal that
+// picks the nth weekday of the month or year.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule is the subset of an RFC 5545 recurrence rule used for tasks. The
+// time of day of every occurrence is the one of the first occurrence.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count limits the series to that many occurrences, Until to occurrences
+	// up to that time. Both are zero when the series is endless.
+	Count int
+	Until time.Time
+	// UntilDate is set when UNTIL is a date, meaning up to the end of that
+	// day in the time zone the rule is evaluated in.
+	UntilDate  bool
+	ByDay      []Weekday
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". A leading
+// "RRULE:" is accepted. Parts other than FREQ, INTERVAL, COUNT, UNTIL, BYDAY,
+// BYMONTHDAY, BYMONTH, BYSETPOS and WKST are rejected.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("empty rule")
+	}
+
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			switch f := Frequency(value); f {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = parseInt(value, 1, 1000)
+		case "COUNT":
+			r.Count, err = parseInt(value, 1, 10000)
+		case "UNTIL":
+			if r.Until, err = time.Parse(untilLayout, value); err != nil {
+				r.Until, err = time.Parse(untilDateLayout, value)
+				r.UntilDate = err == nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %s", value)
+			}
+		case "BYDAY":
+			for _, item := range strings.Split(value, ",") {
+				day, err := parseWeekday(item)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(value, 1, 12)
+			for _, m := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			r.BySetPos, err = parseIntList(value, -366, 366)
+		case "WKST":
+			day, ok := weekdayNames[value]
+			if !ok {
+				return nil, fmt.Errorf("invalid WKST %s", value)
+			}
+			r.WeekStart = day
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	for _, day := range r.ByDay {
+		if day.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, fmt.Errorf("BYDAY ordinals need FREQ=MONTHLY or FREQ=YEARLY")
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == Weekly {
+		return nil, fmt.Errorf("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	if len(r.BySetPos) > 0 && len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && len(r.ByMonth) == 0 {
+		return nil, fmt.Errorf("BYSETPOS needs another BY rule part")
+	}
+	return r, nil
+}
+
+func parseInt(value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max || n == 0 {
+		return 0, fmt.Errorf("%s is out of range", value)
+	}
+	return n, nil
+}
+
+func parseIntList(value string, min, max int) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := parseInt(item, min, max)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseWeekday(value string) (Weekday, error) {
+	if len(value) < 2 {
+		return Weekday{}, fmt.Errorf("invalid BYDAY %s", value)
+	}
+	day, ok := weekdayNames[value[len(value)-2:]]
+	if !ok {
+		return Weekday{}, fmt.Errorf("invalid BYDAY %s", value)
+	}
+	w := Weekday{Day: day}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := parseInt(strings.TrimPrefix(prefix, "+"), -53, 53)
+		if err != nil {
+			return Weekday{}, fmt.Errorf("invalid BYDAY %s", value)
+		}
+		w.N = n
+	}
+	return w, nil
+}
+
+// String returns the rule in canonical form, without the "RRULE:" prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.UntilDate {
+		parts = append(parts, "UNTIL="+r.Until.Format(untilDateLayout))
+	} else if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, day := range r.ByDay {
+			name := weekdayName(day.Day)
+			if day.N != 0 {
+				name = strconv.Itoa(day.N) + name
+			}
+			days = append(days, name)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]int, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = int(m)
+		}
+		parts = append(parts, "BYMONTH="+joinInts(months))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinInts(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayName(r.WeekStart))
+	}
+	return strings.Join(parts, ";")
+}
+
+func weekdayName(day time.Weekday) string {
+	for name, d := range weekdayNames {
+		if d == day {
+			return name
+		}
+	}
+	return ""
+}
+
+func joinInts(values []int) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = strconv.Itoa(v)
+	}
+	return strings.Join(items, ",")
+}
+
+// sortTimes sorts occurrences in place and drops duplicates.
+func sortTimes(times []time.Time) []time.Time {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	unique := times[:0]
+	for i, t := range times {
+		if i == 0 || !t.Equal(times[i-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
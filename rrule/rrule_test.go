@@ -0,0 +1,219 @@
+package rrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:freq=weekly;interval=2;byday=mo,th", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", "FREQ=YEARLY;BYMONTHDAY=29;BYMONTH=2"},
+		{"FREQ=DAILY;COUNT=5", "FREQ=DAILY;COUNT=5"},
+		{"FREQ=WEEKLY;UNTIL=20260320", "FREQ=WEEKLY;UNTIL=20260320"},
+		{"FREQ=DAILY;UNTIL=20260305T140000Z", "FREQ=DAILY;UNTIL=20260305T140000Z"},
+		{"FREQ=WEEKLY;WKST=SU;BYDAY=SU,SA", "FREQ=WEEKLY;BYDAY=SU,SA;WKST=SU"},
+	}
+	for _, tt := range tests {
+		rule, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCountAndUntil(t *testing.T) {
+	rule, err := Parse("FREQ=DAILY;COUNT=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Count != 5 || !rule.Until.IsZero() {
+		t.Errorf("COUNT=5 parsed as Count %d, Until %v", rule.Count, rule.Until)
+	}
+
+	rule, err = Parse("FREQ=WEEKLY;UNTIL=20260320")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.UntilDate || !rule.Until.Equal(time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("UNTIL=20260320 parsed as %v, date %v", rule.Until, rule.UntilDate)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "empty rule"},
+		{"INTERVAL=2", "FREQ is required"},
+		{"FREQ=HOURLY", "unsupported FREQ"},
+		{"FREQ=DAILY;FREQ=WEEKLY", "given twice"},
+		{"FREQ=DAILY;INTERVAL=0", "invalid INTERVAL"},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20260320", "cannot be combined"},
+		{"FREQ=DAILY;UNTIL=tomorrow", "invalid UNTIL"},
+		{"FREQ=WEEKLY;BYDAY=XX", "XX"},
+		{"FREQ=WEEKLY;BYDAY=2MO", "BYDAY ordinals"},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", "BYMONTHDAY cannot be used"},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", "invalid BYMONTHDAY"},
+		{"FREQ=YEARLY;BYMONTH=13", "invalid BYMONTH"},
+		{"FREQ=MONTHLY;BYSETPOS=1", "BYSETPOS needs"},
+		{"FREQ=DAILY;BYHOUR=9", "unsupported rule part"},
+		{"FREQ=DAILY;INTERVAL", "invalid rule part"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data is not available:", err)
+	}
+	monday := time.Date(2026, 3, 2, 9, 0, 0, 0, ny)
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		want  []string
+	}{
+		{
+			"daily",
+			"FREQ=DAILY", monday,
+			[]string{"2026-03-03 09:00 EST", "2026-03-04 09:00 EST", "2026-03-05 09:00 EST"},
+		},
+		{
+			"daily keeps the local time across the spring DST change",
+			"FREQ=DAILY", time.Date(2026, 3, 6, 9, 0, 0, 0, ny),
+			[]string{"2026-03-07 09:00 EST", "2026-03-08 09:00 EDT", "2026-03-09 09:00 EDT"},
+		},
+		{
+			"daily keeps the local time across the fall DST change",
+			"FREQ=DAILY", time.Date(2026, 10, 31, 9, 0, 0, 0, ny),
+			[]string{"2026-11-01 09:00 EST", "2026-11-02 09:00 EST"},
+		},
+		{
+			"weekends",
+			"FREQ=DAILY;BYDAY=SA,SU", monday,
+			[]string{"2026-03-07 09:00 EST", "2026-03-08 09:00 EDT", "2026-03-14 09:00 EDT", "2026-03-15 09:00 EDT"},
+		},
+		{
+			"every other week on Monday and Thursday",
+			"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", monday,
+			[]string{"2026-03-05 09:00 EST", "2026-03-16 09:00 EDT", "2026-03-19 09:00 EDT", "2026-03-30 09:00 EDT"},
+		},
+		{
+			"weekly on the weekday of the start",
+			"FREQ=WEEKLY", monday,
+			[]string{"2026-03-09 09:00 EDT", "2026-03-16 09:00 EDT"},
+		},
+		{
+			"last Friday of the month",
+			"FREQ=MONTHLY;BYDAY=-1FR", monday,
+			[]string{"2026-03-27 09:00 EDT", "2026-04-24 09:00 EDT", "2026-05-29 09:00 EDT", "2026-06-26 09:00 EDT"},
+		},
+		{
+			"second Tuesday of the month",
+			"FREQ=MONTHLY;BYDAY=2TU", monday,
+			[]string{"2026-03-10 09:00 EDT", "2026-04-14 09:00 EDT", "2026-05-12 09:00 EDT"},
+		},
+		{
+			"last weekday of the month",
+			"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", monday,
+			[]string{"2026-03-31 09:00 EDT", "2026-04-30 09:00 EDT", "2026-05-29 09:00 EDT", "2026-06-30 09:00 EDT"},
+		},
+		{
+			"the 15th of the month",
+			"FREQ=MONTHLY;BYMONTHDAY=15", monday,
+			[]string{"2026-03-15 09:00 EDT", "2026-04-15 09:00 EDT"},
+		},
+		{
+			"the 31st skips shorter months",
+			"FREQ=MONTHLY;BYMONTHDAY=31", monday,
+			[]string{"2026-03-31 09:00 EDT", "2026-05-31 09:00 EDT", "2026-07-31 09:00 EDT", "2026-08-31 09:00 EDT"},
+		},
+		{
+			"last day of the month",
+			"FREQ=MONTHLY;BYMONTHDAY=-1", time.Date(2026, 1, 31, 9, 0, 0, 0, ny),
+			[]string{"2026-02-28 09:00 EST", "2026-03-31 09:00 EDT", "2026-04-30 09:00 EDT"},
+		},
+		{
+			"monthly from the 31st",
+			"FREQ=MONTHLY", time.Date(2026, 1, 31, 9, 0, 0, 0, ny),
+			[]string{"2026-03-31 09:00 EDT", "2026-05-31 09:00 EDT"},
+		},
+		{
+			"February 29th",
+			"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", monday,
+			[]string{"2028-02-29 09:00 EST", "2032-02-29 09:00 EST", "2036-02-29 09:00 EST"},
+		},
+		{
+			"until a date includes that day",
+			"FREQ=WEEKLY;UNTIL=20260316", monday,
+			[]string{"2026-03-09 09:00 EDT", "2026-03-16 09:00 EDT", "end"},
+		},
+		{
+			"until a time includes that moment",
+			"FREQ=DAILY;UNTIL=20260304T140000Z", monday,
+			[]string{"2026-03-03 09:00 EST", "2026-03-04 09:00 EST", "end"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := occurrences(rule, tt.start, ny, len(tt.want))
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("%s from %s\n got  %v\n want %v", tt.rule, tt.start.Format(layout), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextCountIsLeftToTheCaller(t *testing.T) {
+	rule, err := Parse("FREQ=DAILY;COUNT=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	got := occurrences(rule, start, time.UTC, 3)
+	if strings.Join(got, ", ") != "2026-03-03 09:00 UTC, 2026-03-04 09:00 UTC, 2026-03-05 09:00 UTC" {
+		t.Errorf("Next gave %v", got)
+	}
+}
+
+const layout = "2006-01-02 15:04 MST"
+
+// occurrences formats the first limit occurrences following start. When the
+// series ends first the last entry is "end".
+func occurrences(rule *Rule, start time.Time, loc *time.Location, limit int) []string {
+	var got []string
+	after := start
+	for len(got) < limit {
+		next, ok := rule.Next(start, after, loc)
+		if !ok {
+			return append(got, "end")
+		}
+		got = append(got, next.Format(layout))
+		after = next
+	}
+	return got
+}
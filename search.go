@@ -0,0 +1,184 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// searchConfig is the text search configuration of the search_vector column.
+	searchConfig        = "english"
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	searchHeadlineTitle = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+	searchHeadlineBody  = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// taskSearchMigrations add the generated search column and its GIN index.
+// Title matches rank above description matches.
+var taskSearchMigrations = []string{
+	`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('` + searchConfig + `', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('` + searchConfig + `', coalesce(description, '')), 'B')
+	) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)",
+}
+
+// SearchResult is one task found by GET /api/search. Snippets are HTML with
+// matches wrapped in <mark>, everything else is escaped.
+type SearchResult struct {
+	Task               models.Task `json:"task"`
+	Rank               float64     `json:"rank"`
+	TitleSnippet       string      `json:"title_snippet"`
+	DescriptionSnippet string      `json:"description_snippet"`
+}
+
+// taskSearchRow is what the search query scans into.
+type taskSearchRow struct {
+	models.Task
+	Rank               float64
+	TitleSnippet       string
+	DescriptionSnippet string
+}
+
+// searchTerms splits a word into the letters and digits tsquery accepts.
+func searchTerms(word string) []string {
+	return strings.FieldsFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// buildTSQuery turns a search box query into to_tsquery syntax. Words must
+// all match, "quoted words" must appear as a phrase, a trailing * matches
+// prefixes, a leading - excludes a word and OR between words matches either.
+// It returns an empty string when nothing searchable is left.
+func buildTSQuery(q string) string {
+	var parts []string
+	join := " & "
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		// Phrases
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase, q = q[1:], ""
+			} else {
+				phrase, q = q[1:end+1], q[end+2:]
+			}
+			var words []string
+			for _, word := range strings.Fields(phrase) {
+				words = append(words, searchTerms(word)...)
+			}
+			if len(words) > 0 {
+				parts = appendTSQueryPart(parts, join, "("+strings.Join(words, " <-> ")+")")
+				join = " & "
+			}
+			continue
+		}
+
+		word := q
+		if i := strings.IndexAny(q, " \t\""); i >= 0 {
+			word, q = q[:i], q[i:]
+		} else {
+			q = ""
+		}
+
+		if word == "OR" && len(parts) > 0 {
+			join = " | "
+			continue
+		}
+		negate := strings.HasPrefix(word, "-")
+		prefix := strings.HasSuffix(word, "*")
+		terms := searchTerms(word)
+		if len(terms) == 0 {
+			continue
+		}
+		part := strings.Join(terms, " <-> ")
+		if prefix {
+			part += ":*"
+		}
+		if len(terms) > 1 {
+			part = "(" + part + ")"
+		}
+		if negate {
+			part = "!" + part
+		}
+		parts = appendTSQueryPart(parts, join, part)
+		join = " & "
+	}
+	return strings.Join(parts, "")
+}
+
+// appendTSQueryPart adds a part to the query, joined to the previous one.
+func appendTSQueryPart(parts []string, join, part string) []string {
+	if len(parts) > 0 {
+		parts = append(parts, join)
+	}
+	return append(parts, part)
+}
+
+// safeSnippet escapes a ts_headline result while keeping its <mark> tags.
+func safeSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer("&lt;mark&gt;", "<mark>", "&lt;/mark&gt;", "</mark>").Replace(escaped)
+}
+
+func SearchTasks(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	tsquery := buildTSQuery(c.Query("q"))
+	if tsquery == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one word"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSearchLimit)})
+			return
+		}
+		limit = n
+	}
+
+	// Scoped to the user's tasks just like GetAllTasks
+	query := "to_tsquery('" + searchConfig + "', ?)"
+	var rows []taskSearchRow
+	err := db.Model(&models.Task{}).
+		Select("tasks.*, "+
+			"ts_rank_cd(search_vector, "+query+") AS rank, "+
+			"ts_headline('"+searchConfig+"', title, "+query+", '"+searchHeadlineTitle+"') AS title_snippet, "+
+			"ts_headline('"+searchConfig+"', coalesce(description, ''), "+query+", '"+searchHeadlineBody+"') AS description_snippet",
+			tsquery, tsquery, tsquery).
+		Where("user_id = ?", user.ID).
+		Where("search_vector @@ "+query, tsquery).
+		Order("rank DESC, id").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		log.Println("Error searching tasks:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search tasks"})
+		return
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			Task:               row.Task,
+			Rank:               row.Rank,
+			TitleSnippet:       safeSnippet(row.TitleSnippet),
+			DescriptionSnippet: safeSnippet(row.DescriptionSnippet),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
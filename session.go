@@ -0,0 +1,392 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"task-manager-app/render"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errSessionRevoked = errors.New("session has been revoked")
+	errRefreshReused  = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is returned to the client whenever a session is created or refreshed.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Warning      string `json:"warning,omitempty"`
+}
+
+// RefreshRequest carries the refresh token for /auth/refresh and /logout.
+// Browsers may omit it and rely on the refresh token cookie instead.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// refreshTokenCookie is the HttpOnly cookie holding the refresh token for browser sessions.
+const refreshTokenCookie = "refresh_token"
+
+// generateRandomToken returns a URL-safe random string with 256 bits of entropy.
+func generateRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 of an opaque token. Tokens are
+// long and random, so a fast hash is enough to keep them safe at rest.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionTouchInterval limits how often last_seen_at is written.
+const sessionTouchInterval = time.Minute
+
+// createSession starts a new login session for the user and returns the
+// first access/refresh token pair for it. The device that logged in is
+// recorded so users can recognise their sessions.
+func createSession(c *gin.Context, userID uuid.UUID) (*TokenPair, error) {
+	var pair *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			ID:         uuid.New(),
+			UserID:     userID,
+			UserAgent:  c.Request.UserAgent(),
+			IP:         c.ClientIP(),
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(refreshTokenTTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokenPair(tx, &session)
+		return err
+	})
+	return pair, err
+}
+
+// issueTokenPair stores a fresh refresh token for the session and signs a
+// matching access token.
+func issueTokenPair(tx *gorm.DB, session *models.Session) (*TokenPair, error) {
+	refreshToken, err := generateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		ID:        uuid.New(),
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateJWTToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// rotateRefreshToken exchanges a refresh token for a new pair. A token that
+// was already used means it has leaked, so the whole session is revoked.
+func rotateRefreshToken(c *gin.Context, refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reused bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&record).Error; err != nil {
+			return err
+		}
+
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", record.SessionID).
+			First(&session).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if record.UsedAt != nil {
+			reused = true
+			if session.RevokedAt == nil {
+				return tx.Model(&session).Update("revoked_at", now).Error
+			}
+			return nil
+		}
+		if !session.Active(now) || now.After(record.ExpiresAt) {
+			return errSessionRevoked
+		}
+
+		if err := tx.Model(&record).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"ip":           c.ClientIP(),
+			"user_agent":   c.Request.UserAgent(),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokenPair(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, errRefreshReused
+	}
+	return pair, nil
+}
+
+// getActiveSession loads a session and makes sure it has not been revoked or expired.
+func getActiveSession(sessionID uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := db.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errSessionRevoked
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if !session.Active(now) {
+		return nil, errSessionRevoked
+	}
+
+	// Keep track of when the session was last used
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := db.Model(&session).UpdateColumn("last_seen_at", now).Error; err != nil {
+			log.Println("Error updating session last seen:", err)
+		}
+	}
+	return &session, nil
+}
+
+// revokeSession marks a single session as revoked.
+func revokeSession(sessionID uuid.UUID) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeUserSessions revokes every session of the user.
+func revokeUserSessions(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// setSessionCookies stores the token pair in HttpOnly cookies so that page
+// navigation is authenticated without exposing tokens in URLs.
+func setSessionCookies(c *gin.Context, pair *TokenPair) {
+	secure := c.Request.TLS != nil
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(middleware.AccessTokenCookie, pair.Token, int(accessTokenTTL.Seconds()), "/", "", secure, true)
+	c.SetCookie(refreshTokenCookie, pair.RefreshToken, int(refreshTokenTTL.Seconds()), "/", "", secure, true)
+}
+
+// clearSessionCookies removes the session cookies from the browser.
+func clearSessionCookies(c *gin.Context) {
+	secure := c.Request.TLS != nil
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(middleware.AccessTokenCookie, "", -1, "/", "", secure, true)
+	c.SetCookie(refreshTokenCookie, "", -1, "/", "", secure, true)
+}
+
+// refreshTokenFromRequest reads the refresh token from the request body,
+// falling back to the refresh token cookie.
+func refreshTokenFromRequest(c *gin.Context) (string, bool) {
+	var req RefreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&req); err != nil {
+			return "", false
+		}
+	}
+	if req.RefreshToken != "" {
+		return req.RefreshToken, true
+	}
+	if cookie, err := c.Cookie(refreshTokenCookie); err == nil && cookie != "" {
+		return cookie, true
+	}
+	return "", false
+}
+
+// hasPageSession reports whether a page request comes from a logged in
+// browser, transparently refreshing an expired access token cookie.
+func hasPageSession(c *gin.Context) bool {
+	if token, ok := middleware.TokenFromRequest(c); ok && CheckTokenValidity(token) == nil {
+		return true
+	}
+
+	refreshToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil || refreshToken == "" {
+		return false
+	}
+	pair, err := rotateRefreshToken(c, refreshToken)
+	if err != nil {
+		clearSessionCookies(c)
+		return false
+	}
+	setSessionCookies(c, pair)
+	return true
+}
+
+func RefreshSession(c *gin.Context) {
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "refresh token is missing"})
+		return
+	}
+
+	pair, err := rotateRefreshToken(c, refreshToken)
+	if err != nil {
+		if err == errRefreshReused {
+			log.Println("warning: refresh token reuse detected, session revoked")
+		} else if err != gorm.ErrRecordNotFound && err != errSessionRevoked {
+			log.Println("Error refreshing session:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to refresh session."})
+			return
+		}
+		clearSessionCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "error": "invalid refresh token"})
+		return
+	}
+
+	setSessionCookies(c, pair)
+	c.JSON(http.StatusOK, pair)
+}
+
+func Logout(c *gin.Context) {
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "error": "refresh token is missing"})
+		return
+	}
+	clearSessionCookies(c)
+
+	var record models.RefreshToken
+	if err := db.Where("token_hash = ?", hashToken(refreshToken)).First(&record).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			log.Println("Error fetching refresh token:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to log out."})
+			return
+		}
+		// Unknown tokens are treated as already logged out
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+		return
+	}
+
+	if err := revokeSession(record.SessionID); err != nil {
+		log.Println("Error revoking session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "error": "Failed to log out."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+func LogoutAll(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	clearSessionCookies(c)
+
+	if err := revokeUserSessions(db, user.ID); err != nil {
+		log.Println("Error revoking sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions"})
+}
+
+// SessionResponse is a session as shown on the security page.
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func ListSessions(c *gin.Context) {
+	auth := middleware.CurrentAuth(c)
+
+	var sessions []models.Session
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", auth.User.ID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		log.Println("Error fetching sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	data := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, SessionResponse{Session: session, Current: session.ID == auth.SessionID})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+func DeleteSession(c *gin.Context) {
+	auth := middleware.CurrentAuth(c)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, auth.User.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Println("Error revoking session:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if id == auth.SessionID {
+		clearSessionCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+func SecurityPage(c *gin.Context) {
+	if !hasPageSession(c) {
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+
+	render.RenderTemplate(c, "security", nil)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"task-manager-app/keyring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signingKeys signs and verifies every JWT issued by the app.
+var signingKeys *keyring.Keyring
+
+// loadSigningKeys reads the keyring from KEYS_DIR. Keys are generated with
+// cmd/keys; only when KEYS_AUTOGENERATE=true, meant for development, does a
+// missing keyring get a fresh key instead of stopping the server.
+func loadSigningKeys() {
+	dir := os.Getenv("KEYS_DIR")
+	if dir == "" {
+		dir = "keys"
+	}
+
+	ring, err := keyring.Load(dir)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, keyring.ErrNoActiveKey) {
+		if os.Getenv("KEYS_AUTOGENERATE") != "true" {
+			panic("No signing key in " + dir + ", generate one with `go run ./cmd/keys -dir " + dir + " generate` " +
+				"or set KEYS_AUTOGENERATE=true in development: " + err.Error())
+		}
+		algorithm := os.Getenv("JWT_ALGORITHM")
+		if algorithm == "" {
+			algorithm = keyring.RS256
+		}
+		kid, genErr := keyring.Generate(dir, algorithm)
+		if genErr != nil {
+			panic("Failed to generate signing key: " + genErr.Error())
+		}
+		log.Println("generated new", algorithm, "signing key:", kid)
+		ring, err = keyring.Load(dir)
+	}
+	if err != nil {
+		panic("Failed to load signing keys: " + err.Error())
+	}
+
+	signingKeys = ring
+}
+
+// reloadSigningKeysOnSignal re-reads the key directory on SIGHUP so a key
+// rotated with cmd/keys is used without restarting the server.
+func reloadSigningKeysOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := signingKeys.Reload(); err != nil {
+				log.Println("Error reloading signing keys:", err)
+				continue
+			}
+			log.Println("signing keys reloaded, active key:", signingKeys.ActiveID())
+		}
+	}()
+}
+
+// JWKS publishes the public keys so other services can verify our tokens.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, signingKeys.JWKS())
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"task-manager-app/models"
+	"task-manager-app/oidc"
+	"task-manager-app/render"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie  = "oidc_state"
+	oidcStatePurpose = "oidc_state"
+	oidcStateTTL     = 10 * time.Minute
+)
+
+// oidcProviders holds the configured identity providers by name.
+var oidcProviders = map[string]*oidc.Provider{}
+
+// OIDCStateClaims travel in a signed cookie between /auth/oidc/login and the
+// callback, binding the callback to the browser that started the flow.
+type OIDCStateClaims struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Purpose      string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+// setupOIDCProviders registers the providers configured in the environment.
+func setupOIDCProviders() {
+	for _, cfg := range oidc.ConfigsFromEnv(appURL + "/auth/oidc/callback") {
+		oidcProviders[cfg.Name] = oidc.NewProvider(cfg, nil)
+		log.Println("OIDC provider configured:", cfg.Name)
+	}
+}
+
+// oidcProviderNames lists the configured providers for the login page.
+func oidcProviderNames() []string {
+	names := make([]string, 0, len(oidcProviders))
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseOIDCState(tokenString string) (*OIDCStateClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &OIDCStateClaims{}, signingKeys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*OIDCStateClaims)
+	if !ok || !token.Valid || claims.Purpose != oidcStatePurpose {
+		return nil, errors.New("invalid oidc state")
+	}
+	return claims, nil
+}
+
+var (
+	// errIdentityNotLinked is returned when an account with the email of a new
+	// identity exists and the provider may not link to it.
+	errIdentityNotLinked = errors.New("an account with this email already exists")
+	errUnverifiedEmail   = errors.New("identity provider did not return a verified email")
+)
+
+// findOrProvisionOIDCUser returns the user linked to the identity, creating a
+// new one for unknown emails. Existing accounts with the same verified email
+// are only linked when the provider is configured to do so.
+func findOrProvisionOIDCUser(provider *oidc.Provider, claims *oidc.IDTokenClaims) (*models.User, error) {
+	user := &models.User{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider.Name, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.Where("id = ?", identity.UserID).First(user).Error
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		// Only trust the email for linking when the provider verified it
+		if claims.Email == "" || !claims.EmailVerified {
+			return errUnverifiedEmail
+		}
+
+		err = tx.Unscoped().Where("email = ?", claims.Email).First(user).Error
+		if err == nil && user.DeletedAt.Valid {
+			return errors.New("the account with this email was deleted")
+		}
+		if err == nil && !provider.LinkByEmail {
+			return errIdentityNotLinked
+		}
+		if err == gorm.ErrRecordNotFound {
+			now := time.Now()
+			*user = models.User{
+				ID:              uuid.New(),
+				FirstName:       claims.GivenName,
+				LastName:        claims.FamilyName,
+				Email:           claims.Email,
+				EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+			log.Println("provisioned user from", provider.Name+":", user.ID)
+		} else if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			ID:       uuid.New(),
+			UserID:   user.ID,
+			Provider: provider.Name,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func OIDCLogin(c *gin.Context) {
+	name := c.Query("provider")
+	provider, ok := oidcProviders[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			log.Println("Error generating OIDC state:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println("Error building OIDC authorization URL:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+
+	cookie, err := signingKeys.Sign(OIDCStateClaims{
+		Provider:     name,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Purpose:      oidcStatePurpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(oidcStateTTL).Unix(),
+		},
+	})
+	if err != nil {
+		log.Println("Error signing OIDC state:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Lax so the cookie comes back on the top-level redirect from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookie, int(oidcStateTTL.Seconds()), "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func OIDCCallback(c *gin.Context) {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login session is missing, please try again"})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+
+	state, err := parseOIDCState(cookie)
+	if err != nil || c.Query("state") != state.State {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid login state, please try again"})
+		return
+	}
+	if errParam := c.Query("error"); errParam != "" {
+		log.Println("OIDC provider returned an error:", errParam, c.Query("error_description"))
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+
+	provider, ok := oidcProviders[state.Provider]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		log.Println("Error exchanging OIDC code:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "login with identity provider failed"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		log.Println("Error verifying ID token:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login with identity provider failed"})
+		return
+	}
+
+	user, err := findOrProvisionOIDCUser(provider, claims)
+	if err == errIdentityNotLinked {
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Log in with your password instead."})
+		return
+	} else if err != nil {
+		log.Println("Error linking OIDC user:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login with identity provider failed"})
+		return
+	}
+
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been disabled."})
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	if user.MFAEnabledAt != nil {
+		challenge, err := generateMFAChallenge(user.ID)
+		if err != nil {
+			log.Println("Error generating MFA challenge:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT token."})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Header("Referrer-Policy", "no-referrer")
+		render.RenderTemplate(c, "oidc_mfa", gin.H{"MFAToken": challenge})
+		return
+	}
+
+	pair, err := createSession(c, user.ID)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JWT token."})
+		return
+	}
+
+	setSessionCookies(c, pair)
+
+	// Browsers do not send SameSite=Strict cookies on a redirect chain that
+	// started at the provider, so continue with a same-site navigation
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<!DOCTYPE html><meta http-equiv="refresh" content="0;url=/todo">`))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"task-manager-app/oidc"
+	"task-manager-app/oidc/oidctest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+// oidcLogin runs the authorization code flow against a mock identity
+// provider and returns the provider with the verified claims of the user.
+func oidcLogin(t *testing.T, user jwt.MapClaims, linkByEmail bool) (*oidc.Provider, *oidc.IDTokenClaims) {
+	t.Helper()
+	idp := oidctest.NewServer("task-manager")
+	t.Cleanup(idp.Close)
+	provider := oidc.NewProvider(oidc.Config{
+		Name:        "mock",
+		Issuer:      idp.Issuer(),
+		ClientID:    "task-manager",
+		RedirectURL: "http://app.test/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		LinkByEmail: linkByEmail,
+	}, idp.Client())
+	idp.Login(user)
+
+	ctx := context.Background()
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawIDToken, err := provider.Exchange(ctx, code, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, rawIDToken, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, claims
+}
+
+var janeClaims = jwt.MapClaims{
+	"sub":            "subject-1",
+	"email":          "jane@example.com",
+	"email_verified": true,
+	"given_name":     "Jane",
+	"family_name":    "Doe",
+}
+
+func TestFindOrProvisionOIDCUser(t *testing.T) {
+	userID := uuid.New()
+	identityColumns := []string{"id", "user_id", "provider", "subject", "email"}
+	userColumns := []string{"id", "email", "first_name", "deleted_at"}
+
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		linkByEmail bool
+		expect      func(mock sqlmock.Sqlmock)
+		wantErr     error
+		wantNew     bool
+	}{
+		{
+			name:   "known identity",
+			claims: janeClaims,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "user_identities" WHERE provider = \$1 AND subject = \$2`).
+					WithArgs("mock", "subject-1").
+					WillReturnRows(sqlmock.NewRows(identityColumns).AddRow(uuid.New(), userID, "mock", "subject-1", "jane@example.com"))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE id = \$1`).
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userID, "jane@example.com", "Jane", nil))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "new email is provisioned",
+			claims:  janeClaims,
+			wantNew: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "user_identities"`).WillReturnRows(sqlmock.NewRows(identityColumns))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).
+					WithArgs("jane@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns))
+				mock.ExpectExec(`INSERT INTO "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO "user_identities"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:        "existing account is linked when the provider allows it",
+			claims:      janeClaims,
+			linkByEmail: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "user_identities"`).WillReturnRows(sqlmock.NewRows(identityColumns))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userID, "jane@example.com", "Jane", nil))
+				mock.ExpectExec(`INSERT INTO "user_identities"`).
+					WithArgs(sqlmock.AnyArg(), userID, "mock", "subject-1", "jane@example.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "existing account is not linked by default",
+			claims:  janeClaims,
+			wantErr: errIdentityNotLinked,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "user_identities"`).WillReturnRows(sqlmock.NewRows(identityColumns))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE email = \$1`).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userID, "jane@example.com", "Jane", nil))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:        "unverified email is not trusted",
+			claims:      jwt.MapClaims{"sub": "subject-1", "email": "jane@example.com", "email_verified": false},
+			linkByEmail: true,
+			wantErr:     errUnverifiedEmail,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "user_identities"`).WillReturnRows(sqlmock.NewRows(identityColumns))
+				mock.ExpectRollback()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, claims := oidcLogin(t, tt.claims, tt.linkByEmail)
+			mock := mockDB(t)
+			tt.expect(mock)
+
+			user, err := findOrProvisionOIDCUser(provider, claims)
+			if err != tt.wantErr {
+				t.Fatalf("findOrProvisionOIDCUser error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if user.Email != "jane@example.com" {
+				t.Errorf("user email = %q", user.Email)
+			}
+			if tt.wantNew {
+				if user.ID == userID || user.FirstName != "Jane" || user.LastName != "Doe" || user.EmailVerifiedAt == nil {
+					t.Errorf("provisioned user = %+v", user)
+				}
+			} else if user.ID != userID {
+				t.Errorf("user ID = %s, want the existing %s", user.ID, userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTaskDepth is how many levels a task tree may have, top-level tasks included.
+	maxTaskDepth          = 5
+	maxChecklistItemText  = 500
+	maxChecklistItemCount = 100
+)
+
+var (
+	errTaskCycle        = errors.New("a task cannot be nested inside itself")
+	errTaskTooDeep      = errors.New("tasks are nested too deeply")
+	errChecklistMissing = errors.New("checklist item not found")
+)
+
+// ChecklistItemRequest is the body of POST /api/tasks/:id/checklist and PUT
+// /api/tasks/:id/checklist/:item. Fields left out are not changed.
+type ChecklistItemRequest struct {
+	Text     *string `json:"text"`
+	Done     *bool   `json:"done"`
+	Position *int    `json:"position"`
+}
+
+// findTask loads a task of the user, failing with errTaskNotFound for
+// unknown IDs and tasks of other users.
+func findTask(tx *gorm.DB, userID uuid.UUID, id string) (*models.Task, error) {
+	taskID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	var task models.Task
+	if err := tx.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errTaskNotFound
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// subtreeHeight returns how many levels the task and its subtasks span.
+func subtreeHeight(tx *gorm.DB, taskID uuid.UUID) (int, error) {
+	level := []uuid.UUID{taskID}
+	height := 0
+	for len(level) > 0 && height <= maxTaskDepth {
+		height++
+		var children []uuid.UUID
+		if err := tx.Model(&models.Task{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return 0, err
+		}
+		level = children
+	}
+	return height, nil
+}
+
+// checkTaskParent makes sure the task can be moved under the parent: the
+// parent must not be the task or one of its subtasks, and the resulting tree
+// must not be deeper than maxTaskDepth.
+func checkTaskParent(tx *gorm.DB, task *models.Task, parent *models.Task) error {
+	// Walk up from the parent, the task must not be one of its ancestors
+	depth := 1
+	for current := parent; ; depth++ {
+		if current.ID == task.ID {
+			return errTaskCycle
+		}
+		if current.ParentID == nil {
+			break
+		}
+		if depth >= maxTaskDepth {
+			return errTaskTooDeep
+		}
+		var next models.Task
+		if err := tx.Select("id", "parent_id").Where("id = ?", *current.ParentID).First(&next).Error; err != nil {
+			return err
+		}
+		current = &next
+	}
+
+	height, err := subtreeHeight(tx, task.ID)
+	if err != nil {
+		return err
+	}
+	if depth+height > maxTaskDepth {
+		return errTaskTooDeep
+	}
+	return nil
+}
+
+// applyTaskParent nests the task under the parent named in the input. An
+// empty parent_id turns it back into a top-level task.
+func applyTaskParent(task *models.Task, input *TaskInput, userID uuid.UUID) (map[string]string, error) {
+	if input.ParentID == nil {
+		return nil, nil
+	}
+	if *input.ParentID == "" {
+		task.ParentID = nil
+		return nil, nil
+	}
+
+	parent, err := findTask(db, userID, *input.ParentID)
+	if err == errTaskNotFound {
+		return map[string]string{"parent_id": "parent task not found"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := checkTaskParent(db, task, parent); err == errTaskCycle || err == errTaskTooDeep {
+		return map[string]string{"parent_id": err.Error()}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	task.ParentID = &parent.ID
+	if task.ProjectID == nil {
+		task.ProjectID = parent.ProjectID
+	}
+	return nil, nil
+}
+
+// progressCounts holds how many of a task's items exist and how many are done.
+type progressCounts struct {
+	ID    uuid.UUID
+	Total int
+	Done  int
+}
+
+// fillProgress computes the progress of the tasks from their subtasks and
+// checklist items. Canceled subtasks do not count.
+func fillProgress(tx *gorm.DB, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+
+	var subtasks, items []progressCounts
+	if err := tx.Model(&models.Task{}).
+		Select("parent_id AS id, COUNT(*) AS total, COUNT(*) FILTER (WHERE status = ?) AS done", models.Completed).
+		Where("parent_id IN ? AND status <> ?", ids, models.Canceled).
+		Group("parent_id").Scan(&subtasks).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.ChecklistItem{}).
+		Select("task_id AS id, COUNT(*) AS total, COUNT(*) FILTER (WHERE done) AS done").
+		Where("task_id IN ?", ids).
+		Group("task_id").Scan(&items).Error; err != nil {
+		return err
+	}
+
+	counts := map[uuid.UUID]*progressCounts{}
+	for _, list := range [][]progressCounts{subtasks, items} {
+		for _, c := range list {
+			if counts[c.ID] == nil {
+				counts[c.ID] = &progressCounts{}
+			}
+			counts[c.ID].Total += c.Total
+			counts[c.ID].Done += c.Done
+		}
+	}
+
+	for i := range tasks {
+		task := &tasks[i]
+		if c := counts[task.ID]; c != nil && c.Total > 0 {
+			task.Progress = c.Done * 100 / c.Total
+		} else if task.Status == models.Completed {
+			task.Progress = 100
+		} else {
+			task.Progress = 0
+		}
+	}
+	return nil
+}
+
+// rollUpCompletion completes the task when it asks for auto-completion and
+// every subtask and checklist item is done, then continues with its parent.
+func rollUpCompletion(tx *gorm.DB, taskID *uuid.UUID) error {
+	for depth := 0; taskID != nil && depth < maxTaskDepth; depth++ {
+		var task models.Task
+		if err := tx.Where("id = ?", *taskID).First(&task).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if !task.AutoComplete || task.Status == models.Completed || task.Status == models.Canceled {
+			return nil
+		}
+		workflow, _, err := loadWorkflow(tx, task.UserID)
+		if err != nil {
+			return err
+		}
+		if !workflow.allows(task.Status, models.Completed) {
+			return nil
+		}
+
+		tasks := []models.Task{task}
+		if err := fillProgress(tx, tasks); err != nil {
+			return err
+		}
+		if tasks[0].Progress < 100 {
+			return nil
+		}
+
+		transitionStatus(&task, models.Completed, time.Now())
+		if err := tx.Save(&task).Error; err != nil {
+			return err
+		}
+		if task.Recurrence != "" {
+			if _, err := createNextOccurrence(tx, &task, time.Now()); err != nil {
+				return err
+			}
+		}
+		taskID = task.ParentID
+	}
+	return nil
+}
+
+// orderChecklist preloads checklist items in their display order.
+func orderChecklist(tx *gorm.DB) *gorm.DB {
+	return tx.Order("position, created_at")
+}
+
+// loadChecklistItem loads an item of a task of the user.
+func loadChecklistItem(tx *gorm.DB, userID uuid.UUID, taskID, itemID string) (*models.Task, *models.ChecklistItem, error) {
+	task, err := findTask(tx, userID, taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := uuid.Parse(itemID)
+	if err != nil {
+		return nil, nil, errChecklistMissing
+	}
+
+	var item models.ChecklistItem
+	if err := tx.Where("id = ? AND task_id = ?", id, task.ID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, errChecklistMissing
+		}
+		return nil, nil, err
+	}
+	return task, &item, nil
+}
+
+// applyChecklistItemRequest validates the request and copies it onto the item.
+func applyChecklistItemRequest(item *models.ChecklistItem, req *ChecklistItemRequest) string {
+	if req.Text != nil {
+		item.Text = strings.TrimSpace(*req.Text)
+	}
+	if item.Text == "" {
+		return "text is required"
+	}
+	if len(item.Text) > maxChecklistItemText {
+		return "text is too long"
+	}
+	if req.Done != nil {
+		item.Done = *req.Done
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+	return ""
+}
+
+func GetTask(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	task, err := findTask(db.Preload("Labels").Preload("Checklist", orderChecklist), user.ID, c.Param("id"))
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+		return
+	}
+
+	tasks := []models.Task{*task}
+	if err := fillProgress(db, tasks); err != nil {
+		log.Println("Error computing task progress:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tasks[0])
+}
+
+// ListSubtasks lists the direct subtasks of a task with the filters of GetAllTasks.
+func ListSubtasks(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	task, err := findTask(db, user.ID, c.Param("id"))
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error fetching task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+		return
+	}
+
+	listTasks(c, db.Where("user_id = ? AND parent_id = ?", user.ID, task.ID))
+}
+
+func CreateChecklistItem(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req ChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	item := models.ChecklistItem{ID: uuid.New()}
+	if message := applyChecklistItemRequest(&item, &req); message != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "errors": gin.H{"text": message}})
+		return
+	}
+
+	var tooMany bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		task, err := findTask(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		item.TaskID = task.ID
+
+		// New items go to the end of the list unless placed explicitly
+		var count int64
+		if err := tx.Model(&models.ChecklistItem{}).Where("task_id = ?", task.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxChecklistItemCount {
+			tooMany = true
+			return nil
+		}
+		if req.Position == nil {
+			item.Position = int(count)
+		}
+		return tx.Create(&item).Error
+	})
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err != nil {
+		log.Println("Error creating checklist item:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create checklist item"})
+		return
+	}
+	if tooMany {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "a task can have at most 100 checklist items"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+func UpdateChecklistItem(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req ChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	var item *models.ChecklistItem
+	var message string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		task, found, err := loadChecklistItem(tx, user.ID, c.Param("id"), c.Param("item"))
+		if err != nil {
+			return err
+		}
+		item = found
+		if message = applyChecklistItemRequest(item, &req); message != "" {
+			return nil
+		}
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+		// Ticking off the last item may complete the task
+		return rollUpCompletion(tx, &task.ID)
+	})
+	if err == errTaskNotFound || err == errChecklistMissing {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error updating checklist item:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update checklist item"})
+		return
+	}
+	if message != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "errors": gin.H{"text": message}})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+func DeleteChecklistItem(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		task, item, err := loadChecklistItem(tx, user.ID, c.Param("id"), c.Param("item"))
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(item).Error; err != nil {
+			return err
+		}
+		// The remaining items may all be done
+		return rollUpCompletion(tx, &task.ID)
+	})
+	if err == errTaskNotFound || err == errChecklistMissing {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error deleting checklist item:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete checklist item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "checklist item deleted"})
+}
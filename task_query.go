@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTaskPageSize = 100
+	maxTaskPageSize     = 500
+	defaultTaskSort     = "created_at"
+)
+
+// priorityRankSQL orders priorities by importance rather than alphabetically.
+const priorityRankSQL = "CASE priority WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END"
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// taskSortKey is a column tasks can be sorted by. Cursors store the value of
+// every sort key of the last task as text, cast back with sqlType.
+type taskSortKey struct {
+	expr    string
+	sqlType string
+	value   func(task *models.Task) string
+}
+
+// optionalTimeKey formats a nullable time, sorting tasks without one last.
+func optionalTimeKey(t *time.Time) string {
+	if t == nil {
+		return "infinity"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// priorityRank mirrors priorityRankSQL.
+func priorityRank(priority string) int {
+	switch priority {
+	case models.High:
+		return 3
+	case models.Medium:
+		return 2
+	case models.Low:
+		return 1
+	}
+	return 0
+}
+
+var taskSortKeys = map[string]taskSortKey{
+	"created_at": {"created_at", "timestamptz", func(t *models.Task) string { return t.CreatedAt.Format(time.RFC3339Nano) }},
+	"updated_at": {"updated_at", "timestamptz", func(t *models.Task) string { return t.UpdatedAt.Format(time.RFC3339Nano) }},
+	"due_at":     {"COALESCE(due_at, 'infinity')", "timestamptz", func(t *models.Task) string { return optionalTimeKey(t.DueAt) }},
+	"start_at":   {"COALESCE(start_at, 'infinity')", "timestamptz", func(t *models.Task) string { return optionalTimeKey(t.StartAt) }},
+	"priority":   {priorityRankSQL, "integer", func(t *models.Task) string { return strconv.Itoa(priorityRank(t.Priority)) }},
+	"status":     {"status", "text", func(t *models.Task) string { return t.Status }},
+	"title":      {"title", "text", func(t *models.Task) string { return t.Title }},
+}
+
+// taskIDKey breaks ties so that every task has a unique position.
+var taskIDKey = taskSortKey{"id", "uuid", func(t *models.Task) string { return t.ID.String() }}
+
+// taskOrder is one key of a sort, such as "-due_at".
+type taskOrder struct {
+	key  taskSortKey
+	desc bool
+}
+
+// taskCursor is the decoded form of the opaque next_cursor.
+type taskCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// taskIndexes are expression indexes used to sort tasks, gorm tags cannot express them.
+var taskIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_tasks_user_due_sort ON tasks (user_id, COALESCE(due_at, 'infinity'), id)",
+	"CREATE INDEX IF NOT EXISTS idx_tasks_user_priority_sort ON tasks (user_id, (" + priorityRankSQL + "), id)",
+}
+
+// parseTaskSort reads a comma separated list of sort keys, each optionally
+// prefixed with "-" for descending order. The task ID is always added last.
+func parseTaskSort(sort string) ([]taskOrder, bool) {
+	var orders []taskOrder
+	seen := map[string]bool{}
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		name := strings.TrimPrefix(field, "-")
+		key, ok := taskSortKeys[name]
+		if !ok || seen[name] {
+			return nil, false
+		}
+		seen[name] = true
+		orders = append(orders, taskOrder{key: key, desc: desc})
+	}
+
+	// Ties are broken in the direction of the last key
+	orders = append(orders, taskOrder{key: taskIDKey, desc: orders[len(orders)-1].desc})
+	return orders, true
+}
+
+// encodeTaskCursor returns the cursor pointing after the given task.
+func encodeTaskCursor(sort string, orders []taskOrder, task *models.Task) string {
+	cursor := taskCursor{Sort: sort}
+	for _, order := range orders {
+		cursor.Values = append(cursor.Values, order.key.value(task))
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTaskCursor reads a cursor, which must have been issued for the same sort.
+func decodeTaskCursor(value, sort string, orders []taskOrder) (*taskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	if cursor.Sort != sort || len(cursor.Values) != len(orders) {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// applyTaskCursor only keeps tasks that come after the cursor: for keys
+// k1..kn that is (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for
+// descending keys.
+func applyTaskCursor(query *gorm.DB, orders []taskOrder, cursor *taskCursor) *gorm.DB {
+	var clauses []string
+	var args []interface{}
+	for i, order := range orders {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, orders[j].key.expr+" = CAST(? AS "+orders[j].key.sqlType+")")
+			args = append(args, cursor.Values[j])
+		}
+		op := ">"
+		if order.desc {
+			op = "<"
+		}
+		parts = append(parts, order.key.expr+" "+op+" CAST(? AS "+order.key.sqlType+")")
+		args = append(args, cursor.Values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return query.Where("("+strings.Join(clauses, " OR ")+")", args...)
+}
+
+// applyTaskOrder sorts the query.
+func applyTaskOrder(query *gorm.DB, orders []taskOrder) *gorm.DB {
+	for _, order := range orders {
+		direction := " ASC"
+		if order.desc {
+			direction = " DESC"
+		}
+		query = query.Order(order.key.expr + direction)
+	}
+	return query
+}
+
+// parseRangeBound reads a from/to query parameter: an RFC 3339 time or a
+// date in loc. A date used as upper bound includes the whole day.
+func parseRangeBound(value string, loc *time.Location, upper bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// splitList splits a comma separated query parameter, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// uniqueStrings drops repeated entries, keeping the first occurrence.
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// applyTaskFilters narrows the query by the filters of GET /api/tasks. It
+// returns a message for the first invalid parameter.
+func applyTaskFilters(c *gin.Context, query *gorm.DB, loc *time.Location) (*gorm.DB, string) {
+	if statuses := splitList(c.Query("status")); len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	if priorities := splitList(c.Query("priority")); len(priorities) > 0 {
+		query = query.Where("priority IN ?", priorities)
+	}
+
+	// Date ranges, inclusive from and exclusive to
+	for _, r := range []struct {
+		param  string
+		column string
+		upper  bool
+	}{
+		{"due_from", "due_at", false},
+		{"due_to", "due_at", true},
+		{"start_from", "start_at", false},
+		{"start_to", "start_at", true},
+		{"created_from", "created_at", false},
+		{"created_to", "created_at", true},
+	} {
+		value := c.Query(r.param)
+		if value == "" {
+			continue
+		}
+		t, ok := parseRangeBound(value, loc, r.upper)
+		if !ok {
+			return nil, r.param + " must be a date (YYYY-MM-DD) or an RFC 3339 time"
+		}
+		if r.upper {
+			query = query.Where(r.column+" < ?", t)
+		} else {
+			query = query.Where(r.column+" >= ?", t)
+		}
+	}
+
+	// Case-insensitive match on title and description
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+
+	return query, ""
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// dateLayout is how the dates of all-day tasks are sent.
+	dateLayout = "2006-01-02"
+	// localTimeLayout is the format of HTML datetime-local inputs, read in the task's time zone.
+	localTimeLayout = "2006-01-02T15:04"
+	// maxDescriptionLength caps the size of a task description in bytes.
+	maxDescriptionLength = 20000
+)
+
+// Values of the "due" filter of GET /api/tasks.
+const (
+	DueOverdue  string = "overdue"
+	DueToday    string = "today"
+	DueThisWeek string = "week"
+)
+
+// TaskInput is the body of POST /api/tasks and PUT /api/tasks/:id. Fields
+// left out are not changed; an empty due_at or start_at clears the date.
+type TaskInput struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Status      *string `json:"status"`
+	Priority    *string `json:"priority"`
+	// StartAt and DueAt are RFC 3339 times, or YYYY-MM-DD dates for all-day tasks.
+	StartAt  *string `json:"start_at"`
+	DueAt    *string `json:"due_at"`
+	AllDay   *bool   `json:"all_day"`
+	TimeZone *string `json:"timezone"`
+	// ProjectID moves the task to another project of the user.
+	ProjectID *string `json:"project_id"`
+	// ParentID nests the task under another task, an empty string makes it top-level again.
+	ParentID     *string `json:"parent_id"`
+	AutoComplete *bool   `json:"auto_complete"`
+	// Recurrence is an RRULE or one of daily, weekdays, weekly, monthly and
+	// yearly, an empty string ends the series.
+	Recurrence *string `json:"recurrence"`
+	RepeatFrom *string `json:"repeat_from"`
+}
+
+// loadLocation returns the time zone with the given IANA name, UTC for an empty name.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// userLocation returns the user's time zone, falling back to UTC.
+func userLocation(user *models.User) *time.Location {
+	loc, err := loadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// startOfDay returns midnight of the day t falls on in loc.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// parseTaskTime reads a start or due date. All-day tasks keep only the date,
+// other tasks need a time, either with an offset or local to loc.
+func parseTaskTime(value string, allDay bool, loc *time.Location) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+
+	var t time.Time
+	var err error
+	if t, err = time.Parse(time.RFC3339, value); err != nil {
+		if t, err = time.ParseInLocation(localTimeLayout, value, loc); err != nil {
+			if !allDay {
+				return nil, false
+			}
+			if t, err = time.ParseInLocation(dateLayout, value, loc); err != nil {
+				return nil, false
+			}
+		}
+	}
+
+	if allDay {
+		t = startOfDay(t, loc)
+	}
+	return &t, true
+}
+
+// applyTaskInput validates the input and copies it onto the task. It returns
+// a message for each invalid field. The status is changed separately, see
+// transitionStatus.
+func applyTaskInput(task *models.Task, input *TaskInput) map[string]string {
+	fieldErrors := map[string]string{}
+
+	if input.Title != nil {
+		task.Title = strings.TrimSpace(*input.Title)
+	}
+	if task.Title == "" {
+		fieldErrors["title"] = "title is required"
+	}
+	if input.Description != nil {
+		task.Description = *input.Description
+		if len(task.Description) > maxDescriptionLength {
+			fieldErrors["description"] = "description is too long"
+		}
+	}
+	if input.Priority != nil {
+		switch *input.Priority {
+		case models.Low, models.Medium, models.High:
+			task.Priority = *input.Priority
+		default:
+			fieldErrors["priority"] = "priority must be low, medium or high"
+		}
+	}
+	if input.AutoComplete != nil {
+		task.AutoComplete = *input.AutoComplete
+	}
+	if input.Recurrence != nil {
+		if rule, err := normalizeRecurrence(*input.Recurrence); err != nil {
+			fieldErrors["recurrence"] = err.Error()
+		} else {
+			task.Recurrence = rule
+		}
+	}
+	if input.RepeatFrom != nil {
+		switch *input.RepeatFrom {
+		case models.RepeatFromDue, models.RepeatFromCompletion:
+			task.RepeatFrom = *input.RepeatFrom
+		default:
+			fieldErrors["repeat_from"] = "repeat_from must be due or completion"
+		}
+	}
+	if task.Recurrence != "" && task.RepeatFrom == "" {
+		task.RepeatFrom = models.RepeatFromDue
+	}
+
+	// Time zone and all-day flag decide how the dates are read
+	if input.TimeZone != nil {
+		if _, err := loadLocation(*input.TimeZone); err != nil {
+			fieldErrors["timezone"] = "unknown time zone"
+		} else {
+			task.TimeZone = *input.TimeZone
+		}
+	}
+	if input.AllDay != nil {
+		task.AllDay = *input.AllDay
+	}
+	loc, err := loadLocation(task.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+		dest  **time.Time
+	}{
+		{"start_at", input.StartAt, &task.StartAt},
+		{"due_at", input.DueAt, &task.DueAt},
+	} {
+		if field.value != nil {
+			t, ok := parseTaskTime(*field.value, task.AllDay, loc)
+			if !ok {
+				if task.AllDay {
+					fieldErrors[field.name] = "must be a date (YYYY-MM-DD) or an RFC 3339 time"
+				} else {
+					fieldErrors[field.name] = "must be an RFC 3339 time"
+				}
+				continue
+			}
+			*field.dest = t
+		} else if task.AllDay && *field.dest != nil {
+			// Turning a task into an all-day task keeps only the date
+			day := startOfDay(**field.dest, loc)
+			*field.dest = &day
+		}
+	}
+
+	if task.StartAt != nil && task.DueAt != nil && task.StartAt.After(*task.DueAt) {
+		fieldErrors["start_at"] = "must not be after due_at"
+	}
+
+	return fieldErrors
+}
+
+// applyTaskProject moves the task to the project named in the input, or to
+// the user's Inbox when it has no project yet.
+func applyTaskProject(task *models.Task, input *TaskInput, userID uuid.UUID) (map[string]string, error) {
+	var project *models.Project
+	var err error
+	if input.ProjectID != nil {
+		project, err = findProject(db, userID, *input.ProjectID)
+		if err == errProjectNotFound {
+			return map[string]string{"project_id": "project not found"}, nil
+		}
+	} else if task.ProjectID == nil {
+		project, err = ensureInbox(db, userID)
+	} else {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	task.ProjectID = &project.ID
+	return nil, nil
+}
+
+// applyDueFilter limits the query to open tasks that are overdue, due today
+// or due this week, with days as seen in loc.
+func applyDueFilter(query *gorm.DB, filter string, loc *time.Location, now time.Time) (*gorm.DB, bool) {
+	today := startOfDay(now, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	switch filter {
+	case "":
+		return query, true
+	case DueOverdue:
+		// All-day tasks are only overdue once their day has passed
+		query = query.Where("((all_day = ? AND due_at < ?) OR (all_day = ? AND due_at < ?))", false, now, true, today)
+	case DueToday:
+		query = query.Where("due_at >= ? AND due_at < ?", today, tomorrow)
+	case DueThisWeek:
+		// Weeks start on Monday
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		query = query.Where("due_at >= ? AND due_at < ?", monday, monday.AddDate(0, 0, 7))
+	default:
+		return nil, false
+	}
+
+	return query.Where("status NOT IN ?", []string{models.Completed, models.Canceled}), true
+}
+
+func CreateTask(c *gin.Context) {
+	// Get the authenticated user
+	user := middleware.CurrentUser(c)
+
+	// Check if the JSON data in the request body can be bound to the task input
+	var input TaskInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// New tasks use the user's time zone unless told otherwise
+	task := models.Task{TimeZone: user.TimeZone}
+	if fieldErrors := applyTaskInput(&task, &input); len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	// Nest the task under its parent, subtasks default to the parent's project
+	if fieldErrors, err := applyTaskParent(&task, &input, user.ID); err != nil {
+		log.Println("Error fetching parent task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return
+	} else if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	// Put the task into the requested project or the Inbox
+	if fieldErrors, err := applyTaskProject(&task, &input, user.ID); err != nil {
+		log.Println("Error fetching project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return
+	} else if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	// Set the user ID in the task
+	task.UserID = user.ID
+
+	// Generate a UUID for the task
+	task.ID = uuid.New()
+	// by default set task status to pending
+	task.Status = models.Pending
+
+	// Create the task in the database
+	if err := db.Create(&task).Error; err != nil {
+		log.Println("Error creating task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return
+	}
+
+	// Return the created task with a 201 status code
+	c.JSON(http.StatusCreated, task)
+}
+
+func GetAllTasks(c *gin.Context) {
+	// Get the authenticated user
+	user := middleware.CurrentUser(c)
+
+	query := db.Where("user_id = ?", user.ID)
+	if value := c.Query("project_id"); value != "" {
+		projectID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project_id"})
+			return
+		}
+		query = query.Where("project_id = ?", projectID)
+	}
+	// parent_id=none lists only top-level tasks
+	if value := c.Query("parent_id"); value == "none" {
+		query = query.Where("parent_id IS NULL")
+	} else if value != "" {
+		parentID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent_id"})
+			return
+		}
+		query = query.Where("parent_id = ?", parentID)
+	}
+	listTasks(c, query)
+}
+
+// listTasks responds with a page of the tasks selected by query, applying
+// the filters, sorting and cursor of the request.
+func listTasks(c *gin.Context, query *gorm.DB) {
+	user := middleware.CurrentUser(c)
+
+	// Days are counted in the user's time zone, or the one asked for
+	loc := userLocation(user)
+	if name := c.Query("tz"); name != "" {
+		var err error
+		if loc, err = loadLocation(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown time zone"})
+			return
+		}
+	}
+
+	query, ok := applyDueFilter(query, c.Query("due"), loc, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "due must be one of overdue, today or week"})
+		return
+	}
+	query, message := applyTaskFilters(c, query, loc)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	// Labels by ID or name, label_match=all requires every one of them
+	if labels := uniqueStrings(splitList(c.Query("labels"))); len(labels) > 0 {
+		var err error
+		if query, err = applyLabelFilter(query, user.ID, labels, c.Query("label_match") == "all"); err != nil {
+			log.Println("Error fetching labels:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+			return
+		}
+	}
+
+	// Sorting and keyset pagination
+	sort := c.DefaultQuery("sort", defaultTaskSort)
+	orders, ok := parseTaskSort(sort)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort, use a comma separated list of created_at, updated_at, due_at, start_at, priority, status and title, each optionally prefixed with -"})
+		return
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeTaskCursor(value, sort, orders)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		query = applyTaskCursor(query, orders, cursor)
+	}
+
+	limit := defaultTaskPageSize
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTaskPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxTaskPageSize)})
+			return
+		}
+		limit = n
+	}
+
+	// Retrieve tasks associated with the user, one extra to know whether there are more
+	var tasks []models.Task
+	if err := applyTaskOrder(query, orders).Preload("Labels").Preload("Checklist", orderChecklist).
+		Limit(limit + 1).Find(&tasks).Error; err != nil {
+		log.Println("Error fetching tasks:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+		return
+	}
+
+	var nextCursor string
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		nextCursor = encodeTaskCursor(sort, orders, &tasks[limit-1])
+	}
+
+	if err := fillProgress(db, tasks); err != nil {
+		log.Println("Error computing task progress:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tasks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tasks, "next_cursor": nextCursor})
+}
+
+func UpdateTask(c *gin.Context) {
+	// Get the authenticated user
+	user := middleware.CurrentUser(c)
+
+	// Extract the task ID from the URL route parameters
+	taskID := c.Param("id")
+
+	// Check if the task exists and belongs to the user
+	var task models.Task
+	if err := db.Where("id = ? AND user_id = ?", taskID, user.ID).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	// Parse the request body to get the updated fields
+	var input TaskInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+
+	wasCompleted := task.Status == models.Completed
+
+	// Empty status and priority have always meant "unchanged"
+	if input.Status != nil && *input.Status == "" {
+		input.Status = nil
+	}
+	if input.Priority != nil && *input.Priority == "" {
+		input.Priority = nil
+	}
+
+	if fieldErrors := applyTaskInput(&task, &input); len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	// Status changes follow the user's workflow
+	if input.Status != nil {
+		workflow, _, err := loadWorkflow(db, user.ID)
+		if err != nil {
+			log.Println("Error fetching workflow:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+			return
+		}
+		if !workflow.allows(task.Status, *input.Status) {
+			message := "a " + task.Status + " task cannot be moved to " + *input.Status
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   message,
+				"errors":  gin.H{"status": message},
+				"allowed": workflow.next(task.Status),
+			})
+			return
+		}
+		transitionStatus(&task, *input.Status, time.Now())
+	}
+
+	// Move the task between projects
+	if fieldErrors, err := applyTaskProject(&task, &input, user.ID); err != nil {
+		log.Println("Error fetching project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+		return
+	} else if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	// Move the task within the task tree
+	if fieldErrors, err := applyTaskParent(&task, &input, user.ID); err != nil {
+		log.Println("Error fetching parent task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+		return
+	} else if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "invalid task", "errors": fieldErrors})
+		return
+	}
+
+	var next *models.Task
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&task).Error; err != nil {
+			return err
+		}
+		// Relative reminders follow the due date
+		if err := rescheduleReminders(tx, &task, time.Now()); err != nil {
+			return err
+		}
+		// Completing an occurrence of a recurring task schedules the next one
+		if !wasCompleted && task.Status == models.Completed && task.Recurrence != "" {
+			var err error
+			if next, err = createNextOccurrence(tx, &task, time.Now()); err != nil {
+				return err
+			}
+		}
+		// Turning on auto-completion may complete the task, but a status set
+		// on purpose, such as reopening it, is kept
+		if input.Status == nil {
+			if err := rollUpCompletion(tx, &task.ID); err != nil {
+				return err
+			}
+		}
+		// The task may be the last open subtask of its parent
+		return rollUpCompletion(tx, task.ParentID)
+	})
+	if err != nil {
+		log.Println("Error updating task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+		return
+	}
+
+	if next != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "task updated successfully", "next_task": next})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "task updated successfully"})
+}
+
+func DeleteTask(c *gin.Context) {
+	// Get the authenticated user
+	user := middleware.CurrentUser(c)
+
+	// Extract the task ID from the URL route parameters
+	taskID := c.Param("id")
+
+	// Check if the task exists and belongs to the user
+	var task models.Task
+	if err := db.Where("id = ? AND user_id = ?", taskID, user.ID).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+
+	// Move the task and its subtasks to the trash, see PurgeTrashedTask for
+	// deleting them for good
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := trashTask(tx, &task); err != nil {
+			return err
+		}
+		return rollUpCompletion(tx, task.ParentID)
+	})
+	if err != nil {
+		log.Println("Error deleting task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete task"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "task moved to the trash"})
+}
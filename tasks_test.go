@@ -0,0 +1,33 @@
+package main
+
+import (
+	"task-manager-app/models"
+	"testing"
+)
+
+func TestApplyTaskInputPriority(t *testing.T) {
+	tests := []struct {
+		priority string
+		wantErr  bool
+	}{
+		{models.Low, false},
+		{models.Medium, false},
+		{models.High, false},
+		{"urgent", true},
+		{"High", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.priority, func(t *testing.T) {
+			title, priority := "Water the plants", tt.priority
+			task := models.Task{Priority: models.Medium}
+			fieldErrors := applyTaskInput(&task, &TaskInput{Title: &title, Priority: &priority})
+
+			if _, got := fieldErrors["priority"]; got != tt.wantErr {
+				t.Errorf("priority error = %q, want one: %v", fieldErrors["priority"], tt.wantErr)
+			}
+			if !tt.wantErr && task.Priority != tt.priority {
+				t.Errorf("Priority = %q, want %q", task.Priority, tt.priority)
+			}
+		})
+	}
+}
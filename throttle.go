@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// throttleFreeAttempts failures are allowed before any delay is enforced.
+	throttleFreeAttempts = 3
+	throttleBaseDelay    = time.Second
+	// throttleWindow is how long failures are remembered after the last one.
+	throttleWindow = time.Hour
+)
+
+// throttleRule describes how strictly a kind of key is throttled.
+type throttleRule struct {
+	key string
+	// lockoutAfter is the number of failures that triggers a full lockout.
+	lockoutAfter int
+}
+
+var (
+	errInvalidCredentials = errors.New("invalid email or password")
+
+	// dummyPasswordHash is compared against for unknown emails so that the
+	// response time does not reveal whether an account exists.
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaThrottleKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+// loginThrottleRules returns the keys a login attempt is counted against.
+// IP addresses may be shared, so they tolerate more failures.
+func loginThrottleRules(email, ip string) []throttleRule {
+	return []throttleRule{
+		{key: accountThrottleKey(email), lockoutAfter: loginLockoutThreshold},
+		{key: ipThrottleKey(ip), lockoutAfter: loginLockoutThreshold * 5},
+	}
+}
+
+// compareDummyPassword spends the same time as a real bcrypt comparison.
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcryptCost)
+		if err != nil {
+			log.Println("Error generating dummy password hash:", err)
+		}
+		dummyPasswordHash = hash
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// throttleDelay returns how long to wait after the given number of failures.
+func throttleDelay(failures int) time.Duration {
+	if failures < throttleFreeAttempts {
+		return 0
+	}
+	delay := throttleBaseDelay
+	for i := throttleFreeAttempts; i < failures && delay < loginLockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > loginLockoutDuration {
+		delay = loginLockoutDuration
+	}
+	return delay
+}
+
+// throttleWait returns how long the caller must wait before trying again,
+// or zero when none of the keys is currently locked.
+func throttleWait(keys ...string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := db.Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	now := time.Now()
+	for _, t := range throttles {
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			if d := t.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, nil
+}
+
+// recordFailure counts a failed attempt against every rule, backing off
+// exponentially and locking a key out once it reaches its threshold.
+func recordFailure(rules []throttleRule, email, ip string) {
+	for _, rule := range rules {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var t models.LoginThrottle
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", rule.key).First(&t).Error
+			if err == gorm.ErrRecordNotFound {
+				t = models.LoginThrottle{Key: rule.key}
+			} else if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			if now.Sub(t.UpdatedAt) > throttleWindow {
+				t.Failures = 0
+			}
+			t.Failures++
+
+			lockedUntil := now.Add(throttleDelay(t.Failures))
+			if t.Failures >= rule.lockoutAfter {
+				lockedUntil = now.Add(loginLockoutDuration)
+				if err := tx.Create(&models.Lockout{
+					ID:          uuid.New(),
+					Key:         rule.key,
+					Email:       email,
+					IP:          ip,
+					Failures:    t.Failures,
+					LockedUntil: lockedUntil,
+				}).Error; err != nil {
+					return err
+				}
+				log.Println("warning: locked out", rule.key, "after", t.Failures, "failed attempts")
+				// Start counting again once the lockout ends
+				t.Failures = 0
+			}
+			t.LockedUntil = &lockedUntil
+
+			return tx.Save(&t).Error
+		})
+		if err != nil {
+			log.Println("Error recording failed attempt:", err)
+		}
+	}
+}
+
+// clearThrottle forgets the failures recorded for a key.
+func clearThrottle(tx *gorm.DB, key string) error {
+	return tx.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// respondThrottled answers a request that arrived while locked out.
+func respondThrottled(c *gin.Context, wait time.Duration) {
+	seconds := int(wait.Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"status": "failed", "error": "Too many failed attempts. Please try again later.", "retry_after": seconds})
+}
+
+func AdminListLockouts(c *gin.Context) {
+	query := db.Order("created_at DESC").Limit(adminMaxPageSize)
+	if c.Query("active") == "true" {
+		query = query.Where("cleared_at IS NULL AND locked_until > ?", time.Now())
+	}
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", email)
+	}
+
+	var lockouts []models.Lockout
+	if err := query.Find(&lockouts).Error; err != nil {
+		log.Println("Error fetching lockouts:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": lockouts})
+}
+
+func AdminClearLockout(c *gin.Context) {
+	admin := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var lockout models.Lockout
+		if err := tx.Where("id = ?", c.Param("id")).First(&lockout).Error; err != nil {
+			return err
+		}
+		if err := clearThrottle(tx, lockout.Key); err != nil {
+			return err
+		}
+		// Clear every open lockout of the key, not just this record
+		return tx.Model(&models.Lockout{}).
+			Where("key = ? AND cleared_at IS NULL", lockout.Key).
+			Updates(map[string]interface{}{"cleared_at": time.Now(), "cleared_by": admin.ID}).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "lockout not found"})
+		return
+	} else if err != nil {
+		log.Println("Error clearing lockout:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear lockout"})
+		return
+	}
+
+	log.Println("admin", admin.ID, "cleared lockout", c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "lockout cleared"})
+}
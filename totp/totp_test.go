@@ -0,0 +1,101 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), Step(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Errorf("Code with lowercase secret = %s, %v, want 287082", got, err)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with an invalid secret did not fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(current), 0, current, true},
+		{"previous step within skew", code(current - 1), 0, current - 1, true},
+		{"next step within skew", code(current + 1), 0, current + 1, true},
+		{"surrounding spaces", " " + code(current) + " ", 0, current, true},
+		{"too old", code(current - 2), 0, 0, false},
+		{"too new", code(current + 2), 0, 0, false},
+		{"replay of the last step", code(current), current, 0, false},
+		{"replay of an earlier step", code(current - 1), current - 1, 0, false},
+		{"newer step after an earlier one", code(current + 1), current, current + 1, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"too short", code(current)[:5], 0, 0, false},
+		{"empty", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q has %d characters, want 32", secret, len(secret))
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("generated secret is not usable: %v", err)
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errTaskNotTrashed    = errors.New("task is not in the trash")
+	errProjectNotTrashed = errors.New("project is not in the trash")
+	errLabelNotTrashed   = errors.New("label is not in the trash")
+)
+
+// softDeleteMigrations clear the zero deleted_at values written before soft
+// deletion was enabled, gorm treats any value as deleted.
+var softDeleteMigrations = []string{
+	"UPDATE tasks SET deleted_at = NULL WHERE deleted_at < '0002-01-01'",
+	"UPDATE users SET deleted_at = NULL WHERE deleted_at < '0002-01-01'",
+	// Accounts were scheduled for deletion before users had a trash
+	`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'deletion_scheduled_at') THEN
+			UPDATE users SET deleted_at = NOW() WHERE deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL;
+			ALTER TABLE users DROP COLUMN deletion_scheduled_at;
+		END IF;
+	END $$`,
+}
+
+// TrashedTask is a task in the trash with the time it will be purged.
+type TrashedTask struct {
+	models.Task
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// TrashedProject is a project in the trash with the time it will be purged.
+type TrashedProject struct {
+	models.Project
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// TrashedLabel is a label in the trash with the time it will be purged.
+type TrashedLabel struct {
+	models.Label
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// trashPurgers permanently delete soft-deleted rows older than the cutoff,
+// one for each kind of entity that has a trash.
+var trashPurgers = []struct {
+	name  string
+	purge func(tx *gorm.DB, cutoff time.Time) (int, error)
+}{
+	{"tasks", purgeTrashedTasks},
+	{"projects", purgeTrashedProjects},
+	{"labels", purgeTrashedLabels},
+	{"users", purgeTrashedUsers},
+}
+
+// taskSubtree returns the task and its subtasks, following only subtasks
+// the scope selects. The scope decides whether trashed tasks are included.
+func taskSubtree(tx *gorm.DB, rootID uuid.UUID, scope func(*gorm.DB) *gorm.DB) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{rootID}
+	level := ids
+	for depth := 1; len(level) > 0 && depth < maxTaskDepth; depth++ {
+		var children []uuid.UUID
+		if err := scope(tx.Model(&models.Task{}).Where("parent_id IN ?", level)).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		ids = append(ids, children...)
+		level = children
+	}
+	return ids, nil
+}
+
+// trashTask moves the task and its subtasks to the trash.
+func trashTask(tx *gorm.DB, task *models.Task) error {
+	ids, err := taskSubtree(tx, task.ID, func(q *gorm.DB) *gorm.DB { return q })
+	if err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.Task{}).Error
+}
+
+// findTrashedTask loads a task of the user that is in the trash.
+func findTrashedTask(tx *gorm.DB, userID uuid.UUID, id string) (*models.Task, error) {
+	taskID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	var task models.Task
+	if err := tx.Unscoped().Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errTaskNotFound
+		}
+		return nil, err
+	}
+	if !task.DeletedAt.Valid {
+		return nil, errTaskNotTrashed
+	}
+	return &task, nil
+}
+
+// restoreTask takes the task out of the trash together with the subtasks
+// that were deleted with it. Tasks whose parent is gone become top-level.
+func restoreTask(tx *gorm.DB, task *models.Task) error {
+	ids, err := taskSubtree(tx.Unscoped(), task.ID, func(q *gorm.DB) *gorm.DB {
+		return q.Where("deleted_at = ?", task.DeletedAt.Time)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&models.Task{}).Where("id IN ?", ids).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	task.DeletedAt = gorm.DeletedAt{}
+
+	// A task whose project is still in the trash goes to the Inbox
+	if task.ProjectID != nil {
+		var count int64
+		if err := tx.Model(&models.Project{}).Where("id = ?", *task.ProjectID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			inbox, err := ensureInbox(tx, task.UserID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Task{}).Where("id IN ? AND project_id = ?", ids, *task.ProjectID).
+				Update("project_id", inbox.ID).Error; err != nil {
+				return err
+			}
+			task.ProjectID = &inbox.ID
+		}
+	}
+
+	if task.ParentID == nil {
+		return nil
+	}
+	var parent models.Task
+	err = tx.Where("id = ?", *task.ParentID).First(&parent).Error
+	if err == nil {
+		// The parent may have moved deeper while the task was in the trash
+		err = checkTaskParent(tx, task, &parent)
+	}
+	if err == gorm.ErrRecordNotFound || err == errTaskCycle || err == errTaskTooDeep {
+		task.ParentID = nil
+		return tx.Model(task).Update("parent_id", nil).Error
+	}
+	return err
+}
+
+// trashProject moves the project to the trash together with its tasks. They
+// share the deletion time, which tells them apart from tasks trashed before.
+func trashProject(tx *gorm.DB, project *models.Project) error {
+	now := time.Now()
+	if err := tx.Model(&models.Task{}).Where("project_id = ?", project.ID).Update("deleted_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(project).Update("deleted_at", now).Error
+}
+
+// findTrashedProject loads a project of the user that is in the trash.
+func findTrashedProject(tx *gorm.DB, userID uuid.UUID, id string) (*models.Project, error) {
+	projectID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errProjectNotFound
+	}
+
+	var project models.Project
+	if err := tx.Unscoped().Where("id = ? AND user_id = ?", projectID, userID).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errProjectNotFound
+		}
+		return nil, err
+	}
+	if !project.DeletedAt.Valid {
+		return nil, errProjectNotTrashed
+	}
+	return &project, nil
+}
+
+// restoreProject takes the project out of the trash together with the tasks
+// that were deleted with it.
+func restoreProject(tx *gorm.DB, project *models.Project) error {
+	if err := tx.Unscoped().Model(&models.Task{}).Where("project_id = ? AND deleted_at = ?", project.ID, project.DeletedAt.Time).
+		Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(project).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	project.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// findTrashedLabel loads a label of the user that is in the trash.
+func findTrashedLabel(tx *gorm.DB, userID uuid.UUID, id string) (*models.Label, error) {
+	labelID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errLabelNotFound
+	}
+
+	var label models.Label
+	if err := tx.Unscoped().Where("id = ? AND user_id = ?", labelID, userID).First(&label).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errLabelNotFound
+		}
+		return nil, err
+	}
+	if !label.DeletedAt.Valid {
+		return nil, errLabelNotTrashed
+	}
+	return &label, nil
+}
+
+// restoreLabel takes the label out of the trash, back on the tasks it was
+// on. It fails with errLabelExists when the name has been reused meanwhile.
+func restoreLabel(tx *gorm.DB, label *models.Label) error {
+	taken, err := labelNameTaken(tx, label.UserID, label.Name, label.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errLabelExists
+	}
+	if err := tx.Unscoped().Model(label).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	label.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// purgeTasks permanently deletes tasks with everything that belongs to them.
+func purgeTasks(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, model := range []interface{}{&models.TaskLabel{}, &models.ChecklistItem{}, &models.Reminder{}} {
+		if err := tx.Where("task_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	// Delivered notifications stay, without the link to the task
+	if err := tx.Model(&models.Notification{}).Where("task_id IN ?", ids).Update("task_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&models.Task{}).Where("parent_id IN ?", ids).Update("parent_id", nil).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Task{}).Error
+}
+
+// purgeTrashedTasks permanently deletes tasks trashed before the cutoff.
+func purgeTrashedTasks(tx *gorm.DB, cutoff time.Time) (int, error) {
+	var ids []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Task{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	return len(ids), purgeTasks(tx, ids)
+}
+
+// purgeProjects permanently deletes projects together with their tasks.
+func purgeProjects(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var taskIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Task{}).Where("project_id IN ?", ids).Pluck("id", &taskIDs).Error; err != nil {
+		return err
+	}
+	if err := purgeTasks(tx, taskIDs); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Project{}).Error
+}
+
+// purgeTrashedProjects permanently deletes projects trashed before the cutoff.
+func purgeTrashedProjects(tx *gorm.DB, cutoff time.Time) (int, error) {
+	var ids []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Project{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	return len(ids), purgeProjects(tx, ids)
+}
+
+// purgeLabels permanently deletes labels and takes them off their tasks.
+func purgeLabels(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("label_id IN ?", ids).Delete(&models.TaskLabel{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Label{}).Error
+}
+
+// purgeTrashedLabels permanently deletes labels trashed before the cutoff.
+func purgeTrashedLabels(tx *gorm.DB, cutoff time.Time) (int, error) {
+	var ids []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Label{}).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	return len(ids), purgeLabels(tx, ids)
+}
+
+// purgeTrashedUsers permanently deletes users deleted before the cutoff.
+func purgeTrashedUsers(tx *gorm.DB, cutoff time.Time) (int, error) {
+	var users []models.User
+	if err := tx.Unscoped().Where("deleted_at < ?", cutoff).Find(&users).Error; err != nil {
+		return 0, err
+	}
+	for i := range users {
+		if err := purgeUser(tx, &users[i]); err != nil {
+			return 0, err
+		}
+	}
+	return len(users), nil
+}
+
+// purgeTrash permanently deletes everything that has been in the trash
+// longer than the retention window.
+func purgeTrash() {
+	cutoff := time.Now().Add(-trashRetention)
+	for _, purger := range trashPurgers {
+		var count int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			count, err = purger.purge(tx, cutoff)
+			return err
+		})
+		if err != nil {
+			log.Println("Error purging trashed "+purger.name+":", err)
+			continue
+		}
+		if count > 0 {
+			log.Println("Purged", count, "trashed", purger.name)
+		}
+	}
+}
+
+// startTrashPurger purges the trash now and then every interval.
+func startTrashPurger(interval time.Duration) {
+	go func() {
+		for {
+			purgeTrash()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ListTrash lists the user's trashed tasks, projects and labels, most
+// recently deleted first.
+func ListTrash(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var tasks []models.Task
+	var projects []models.Project
+	var labels []models.Label
+	trashed := func() *gorm.DB {
+		return db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", user.ID).Order("deleted_at DESC, id")
+	}
+	err := trashed().Limit(maxTaskPageSize).Find(&tasks).Error
+	if err == nil {
+		err = trashed().Find(&projects).Error
+	}
+	if err == nil {
+		err = trashed().Find(&labels).Error
+	}
+	if err != nil {
+		log.Println("Error fetching trash:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve trash"})
+		return
+	}
+
+	trashedTasks := make([]TrashedTask, 0, len(tasks))
+	for _, task := range tasks {
+		trashedTasks = append(trashedTasks, TrashedTask{Task: task, PurgeAt: task.DeletedAt.Time.Add(trashRetention)})
+	}
+	trashedProjects := make([]TrashedProject, 0, len(projects))
+	for _, project := range projects {
+		trashedProjects = append(trashedProjects, TrashedProject{Project: project, PurgeAt: project.DeletedAt.Time.Add(trashRetention)})
+	}
+	trashedLabels := make([]TrashedLabel, 0, len(labels))
+	for _, label := range labels {
+		trashedLabels = append(trashedLabels, TrashedLabel{Label: label, PurgeAt: label.DeletedAt.Time.Add(trashRetention)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": trashedTasks, "projects": trashedProjects, "labels": trashedLabels})
+}
+
+// RestoreTask takes a task and the subtasks deleted with it out of the trash.
+func RestoreTask(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var task *models.Task
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if task, err = findTrashedTask(tx, user.ID, c.Param("id")); err != nil {
+			return err
+		}
+		return restoreTask(tx, task)
+	})
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err == errTaskNotTrashed {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error restoring task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore task"})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// RestoreProject takes a project and the tasks deleted with it out of the trash.
+func RestoreProject(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var project *models.Project
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if project, err = findTrashedProject(tx, user.ID, c.Param("id")); err != nil {
+			return err
+		}
+		return restoreProject(tx, project)
+	})
+	if err == errProjectNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	} else if err == errProjectNotTrashed {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		log.Println("Error restoring project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// RestoreLabel takes a label out of the trash, back onto its tasks.
+func RestoreLabel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var label *models.Label
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if label, err = findTrashedLabel(tx, user.ID, c.Param("id")); err != nil {
+			return err
+		}
+		return restoreLabel(tx, label)
+	})
+	if err == errLabelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "label not found"})
+		return
+	} else if err == errLabelNotTrashed {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err == errLabelExists {
+		c.JSON(http.StatusConflict, gin.H{"error": "a label with this name already exists"})
+		return
+	} else if err != nil {
+		log.Println("Error restoring label:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore label"})
+		return
+	}
+
+	c.JSON(http.StatusOK, label)
+}
+
+// PurgeTrashedTask permanently deletes a trashed task and its trashed subtasks.
+func PurgeTrashedTask(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		task, err := findTrashedTask(tx, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		ids, err := taskSubtree(tx.Unscoped(), task.ID, func(q *gorm.DB) *gorm.DB {
+			return q.Where("deleted_at IS NOT NULL")
+		})
+		if err != nil {
+			return err
+		}
+		return purgeTasks(tx, ids)
+	})
+	if err == errTaskNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	} else if err == errTaskNotTrashed {
+		c.JSON(http.StatusConflict, gin.H{"error": "move the task to the trash first"})
+		return
+	} else if err != nil {
+		log.Println("Error purging task:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete task"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "task permanently deleted"})
+}
+
+// EmptyTrash permanently deletes all of the user's trashed tasks, projects
+// and labels.
+func EmptyTrash(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		trashed := func(model interface{}) ([]uuid.UUID, error) {
+			var ids []uuid.UUID
+			err := tx.Unscoped().Model(model).Where("user_id = ? AND deleted_at IS NOT NULL", user.ID).Pluck("id", &ids).Error
+			return ids, err
+		}
+		taskIDs, err := trashed(&models.Task{})
+		if err != nil {
+			return err
+		}
+		if err := purgeTasks(tx, taskIDs); err != nil {
+			return err
+		}
+		projectIDs, err := trashed(&models.Project{})
+		if err != nil {
+			return err
+		}
+		if err := purgeProjects(tx, projectIDs); err != nil {
+			return err
+		}
+		labelIDs, err := trashed(&models.Label{})
+		if err != nil {
+			return err
+		}
+		return purgeLabels(tx, labelIDs)
+	})
+	if err != nil {
+		log.Println("Error emptying trash:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to empty trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "trash emptied"})
+}
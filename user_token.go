@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// issueUserToken creates a single-use token for the given purpose, replacing
+// any unused token of the same purpose, and returns the raw token value.
+func issueUserToken(userID uuid.UUID, purpose, data string, ttl time.Duration) (string, error) {
+	token, err := generateRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			Data:      data,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// redeemUserToken marks a token as used inside tx and returns it. It fails
+// with errInvalidUserToken when the token is unknown, used or expired.
+func redeemUserToken(tx *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var record models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).
+		First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !record.Usable(now) {
+		return nil, errInvalidUserToken
+	}
+
+	if err := tx.Model(&record).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"task-manager-app/middleware"
+	"task-manager-app/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxWorkflowTransitions = 100
+
+// statusPattern is what the names of custom statuses look like.
+var statusPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Workflow maps each status to the statuses a task can move to from it.
+type Workflow map[string][]string
+
+// defaultWorkflow is used by users without a custom workflow. Canceled tasks
+// must be reopened before they can be completed.
+var defaultWorkflow = Workflow{
+	models.Pending:   {models.Active, models.Completed, models.Canceled},
+	models.Active:    {models.Pending, models.Completed, models.Canceled},
+	models.Completed: {models.Pending, models.Active},
+	models.Canceled:  {models.Pending},
+}
+
+// taskStatusMigrations backfill the status timestamps of tasks closed before
+// they were recorded, using the last update as the best guess.
+var taskStatusMigrations = []string{
+	"UPDATE tasks SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL",
+	"UPDATE tasks SET canceled_at = updated_at WHERE status = 'canceled' AND canceled_at IS NULL",
+}
+
+// WorkflowRequest is the body of PUT /api/workflow.
+type WorkflowRequest struct {
+	Transitions map[string][]string `json:"transitions" binding:"required"`
+}
+
+// states returns every status of the workflow in alphabetical order.
+func (w Workflow) states() []string {
+	seen := map[string]bool{}
+	var states []string
+	for from, targets := range w {
+		for _, status := range append([]string{from}, targets...) {
+			if !seen[status] {
+				seen[status] = true
+				states = append(states, status)
+			}
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// next returns the statuses a task in the given status can move to. Statuses
+// without outgoing transitions are final. Tasks in a status the workflow does
+// not know at all, such as one removed from a custom workflow, can move to any
+// status of it.
+func (w Workflow) next(from string) []string {
+	if targets, ok := w[from]; ok {
+		return targets
+	}
+	states := w.states()
+	for _, status := range states {
+		if status == from {
+			return nil
+		}
+	}
+	return states
+}
+
+// allows reports whether a task can move between the two statuses.
+func (w Workflow) allows(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, status := range w.next(from) {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWorkflow returns the user's custom workflow or the default one.
+func loadWorkflow(tx *gorm.DB, userID uuid.UUID) (Workflow, bool, error) {
+	var transitions []models.WorkflowTransition
+	if err := tx.Where("user_id = ?", userID).Order("from_status, to_status").Find(&transitions).Error; err != nil {
+		return nil, false, err
+	}
+	if len(transitions) == 0 {
+		return defaultWorkflow, false, nil
+	}
+
+	workflow := Workflow{}
+	for _, t := range transitions {
+		workflow[t.FromStatus] = append(workflow[t.FromStatus], t.ToStatus)
+	}
+	return workflow, true, nil
+}
+
+// validateWorkflow checks a custom workflow. It must use the pending status
+// new tasks start in, and tasks must be able to get from there to completed.
+func validateWorkflow(transitions map[string][]string) (Workflow, string) {
+	workflow := Workflow{}
+	count := 0
+	for from, targets := range transitions {
+		if !statusPattern.MatchString(from) {
+			return nil, "invalid status " + from + ", use lowercase letters, digits and underscores"
+		}
+		for _, to := range uniqueStrings(targets) {
+			if !statusPattern.MatchString(to) {
+				return nil, "invalid status " + to + ", use lowercase letters, digits and underscores"
+			}
+			if to == from {
+				continue
+			}
+			workflow[from] = append(workflow[from], to)
+			count++
+		}
+	}
+	if count == 0 {
+		return nil, "a workflow needs at least one transition"
+	}
+	if count > maxWorkflowTransitions {
+		return nil, "a workflow can have at most 100 transitions"
+	}
+
+	// Walk the workflow from pending
+	reached := map[string]bool{models.Pending: true}
+	queue := []string{models.Pending}
+	for len(queue) > 0 {
+		status := queue[0]
+		queue = queue[1:]
+		for _, to := range workflow[status] {
+			if !reached[to] {
+				reached[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	if !reached[models.Completed] {
+		return nil, "tasks must be able to get from pending to completed"
+	}
+	return workflow, ""
+}
+
+// transitionStatus moves the task to a status, recording when it was
+// completed or canceled.
+func transitionStatus(task *models.Task, status string, now time.Time) {
+	if task.Status == status {
+		return
+	}
+	task.Status = status
+	task.CompletedAt = nil
+	task.CanceledAt = nil
+	switch status {
+	case models.Completed:
+		task.CompletedAt = &now
+	case models.Canceled:
+		task.CanceledAt = &now
+	}
+}
+
+func GetWorkflow(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	workflow, custom, err := loadWorkflow(db, user.ID)
+	if err != nil {
+		log.Println("Error fetching workflow:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve workflow"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"states": workflow.states(), "transitions": workflow, "custom": custom})
+}
+
+// UpdateWorkflow replaces the user's workflow.
+func UpdateWorkflow(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req WorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request data"})
+		return
+	}
+	workflow, message := validateWorkflow(req.Transitions)
+	if message != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "errors": gin.H{"transitions": message}})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.WorkflowTransition{}).Error; err != nil {
+			return err
+		}
+		var transitions []models.WorkflowTransition
+		for from, targets := range workflow {
+			for _, to := range targets {
+				transitions = append(transitions, models.WorkflowTransition{UserID: user.ID, FromStatus: from, ToStatus: to})
+			}
+		}
+		return tx.Create(&transitions).Error
+	})
+	if err != nil {
+		log.Println("Error updating workflow:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update workflow"})
+		return
+	}
+
+	for from := range workflow {
+		sort.Strings(workflow[from])
+	}
+	c.JSON(http.StatusOK, gin.H{"states": workflow.states(), "transitions": workflow, "custom": true})
+}
+
+// ResetWorkflow goes back to the default workflow.
+func ResetWorkflow(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	if err := db.Where("user_id = ?", user.ID).Delete(&models.WorkflowTransition{}).Error; err != nil {
+		log.Println("Error resetting workflow:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset workflow"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"states": defaultWorkflow.states(), "transitions": defaultWorkflow, "custom": false})
+}